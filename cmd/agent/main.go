@@ -1,35 +1,64 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alex19451/httpserver/internal/agent"
 	"github.com/alex19451/httpserver/internal/config"
-	"github.com/rs/zerolog"
+	"github.com/alex19451/httpserver/internal/logging"
 )
 
 func main() {
 	cfg := config.ParseAgentConfig()
 
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	logger := zerolog.New(os.Stdout).With().
-		Timestamp().
-		Str("component", "agent").
-		Logger()
-
-	switch cfg.LogLevel {
-	case "debug":
-		logger = logger.Level(zerolog.DebugLevel)
-	case "info":
-		logger = logger.Level(zerolog.InfoLevel)
-	case "warn":
-		logger = logger.Level(zerolog.WarnLevel)
-	case "error":
-		logger = logger.Level(zerolog.ErrorLevel)
-	default:
-		logger = logger.Level(zerolog.InfoLevel)
+	logger, logFile, err := logging.New("agent", cfg.Logging())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+	defer logFile.Close()
+
+	ag, err := agent.New(cfg, logger)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create agent")
+		os.Exit(1)
+	}
+
+	reload := make(chan struct{}, 1)
+	if cfg.WatchConfig && cfg.ConfigFile != "" {
+		go config.WatchFile(context.Background(), cfg.ConfigFile, 2*time.Second, func() {
+			select {
+			case reload <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+			case <-reload:
+			}
+
+			next, err := config.LoadAgentConfig(os.Args[1:])
+			if err == nil {
+				err = ag.Reload(next)
+			}
+			if err != nil {
+				logger.Error().Err(err).Msg("config reload failed, keeping the current config")
+				continue
+			}
+			logging.SetLevel(next.LogLevel)
+		}
+	}()
 
-	ag := agent.New(cfg, logger)
 	ag.Run()
 }
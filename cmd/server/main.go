@@ -1,36 +1,35 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/alex19451/httpserver/internal/config"
+	"github.com/alex19451/httpserver/internal/forward"
+	"github.com/alex19451/httpserver/internal/ingest"
+	"github.com/alex19451/httpserver/internal/logging"
+	"github.com/alex19451/httpserver/internal/scrape"
 	"github.com/alex19451/httpserver/internal/server"
+	"github.com/alex19451/httpserver/internal/statsd"
 	"github.com/alex19451/httpserver/internal/storage"
-	"github.com/rs/zerolog"
 )
 
 func main() {
 	cfg := config.ParseServerConfig()
+	if err := server.ValidateConfig(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-	logger := zerolog.New(os.Stdout).With().
-		Timestamp().
-		Str("component", "server").
-		Logger()
-
-	switch cfg.LogLevel {
-	case "debug":
-		logger = logger.Level(zerolog.DebugLevel)
-	case "info":
-		logger = logger.Level(zerolog.InfoLevel)
-	case "warn":
-		logger = logger.Level(zerolog.WarnLevel)
-	case "error":
-		logger = logger.Level(zerolog.ErrorLevel)
-	default:
-		logger = logger.Level(zerolog.InfoLevel)
+	logger, logFile, err := logging.New("server", cfg.Logging())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
 
 	var db *storage.Storage
@@ -42,8 +41,80 @@ func main() {
 
 	srv := server.New(cfg, db, logger)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+
+	if cfg.ForwardTargets != "" {
+		targets, err := forward.ParseTargets(cfg.ForwardTargets)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid forward targets")
+			os.Exit(1)
+		}
+		fw, err := forward.New(targets, cfg.ForwardQueueDir, logger)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create forwarder")
+			os.Exit(1)
+		}
+		srv.SetForwarder(fw)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fw.Run(ctx)
+		}()
+	}
+
+	if cfg.StatsdUDPAddress != "" || cfg.StatsdTCPAddress != "" {
+		flushInterval := time.Duration(cfg.StatsdFlushInterval)
+		sd := statsd.NewListener(cfg.StatsdUDPAddress, cfg.StatsdTCPAddress, flushInterval, srv, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sd.Run(ctx); err != nil {
+				logger.Error().Err(err).Msg("statsd listener error")
+			}
+		}()
+	}
+
+	var gl *ingest.GraphiteListener
+	if cfg.GraphiteAddress != "" {
+		rules, err := ingest.ParseTypeRules(cfg.IngestTypeRules)
+		if err != nil {
+			logger.Error().Err(err).Msg("invalid ingest type rules")
+			os.Exit(1)
+		}
+		gl = ingest.NewGraphiteListener(cfg.GraphiteAddress, rules, srv, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := gl.Run(ctx); err != nil {
+				logger.Error().Err(err).Msg("graphite listener error")
+			}
+		}()
+	}
+
+	if targets := scrape.ParseTargets(cfg.ScrapeTargets); len(targets) > 0 {
+		interval := time.Duration(cfg.ScrapeInterval)
+		timeout := time.Duration(cfg.ScrapeTimeout)
+		sc := scrape.NewScheduler(targets, interval, timeout, srv, logger)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sc.Run(ctx)
+		}()
+	}
+
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP)
+
+	fileChanged := make(chan struct{}, 1)
+	if cfg.WatchConfig && cfg.ConfigFile != "" {
+		go config.WatchFile(ctx, cfg.ConfigFile, 2*time.Second, func() {
+			select {
+			case fileChanged <- struct{}{}:
+			default:
+			}
+		})
+	}
 
 	go func() {
 		if err := srv.Run(); err != nil {
@@ -52,14 +123,48 @@ func main() {
 		}
 	}()
 
-	<-sigChan
+	reload := func() {
+		next, err := config.LoadServerConfig(os.Args[1:])
+		var rules ingest.TypeRules
+		if err == nil {
+			rules, err = ingest.ParseTypeRules(next.IngestTypeRules)
+		}
+		if err == nil {
+			err = srv.Reload(next)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("config reload failed, keeping the current config")
+			return
+		}
+		logging.SetLevel(next.LogLevel)
+		if gl != nil {
+			gl.SetTypeRules(rules)
+		}
+	}
+
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			reload()
+		case <-fileChanged:
+			reload()
+		}
+	}
 	logger.Info().Msg("shutting down server...")
 
+	cancel()
+	wg.Wait()
+
 	if err := db.SaveToFile(); err != nil {
 		logger.Error().Err(err).Msg("error saving data on shutdown")
 	} else {
 		logger.Info().Msg("data saved successfully")
 	}
 
+	logFile.Close()
 	os.Exit(0)
 }
@@ -1,9 +1,30 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/alex19451/httpserver/internal/config"
+	"github.com/alex19451/httpserver/internal/forward"
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/logging"
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/alex19451/httpserver/internal/server"
+	"github.com/alex19451/httpserver/internal/storage"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,3 +47,743 @@ func TestURLFormat(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, url, req.URL.String())
 }
+
+func newTestHandler(t *testing.T, cfg *config.ServerConfig) http.Handler {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.ServerConfig{}
+	}
+	if cfg.StoreInterval == 0 {
+		cfg.StoreInterval = config.Duration(time.Hour)
+	}
+	return server.New(cfg, storage.New(), zerolog.Nop()).Handler()
+}
+
+func serve(h http.Handler, method, target string, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestInfluxWriteReportsApplyLine(t *testing.T) {
+	h := newTestHandler(t, nil)
+
+	rec := serve(h, http.MethodPost, "/write", "cpu usage=1\nbad{x} usage=2\n")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "line 2:")
+	// A rejected batch applies none of its lines.
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/value/gauge/cpu_usage", "").Code)
+
+	big := "cpu usage=1\n" + strings.Repeat("#"+strings.Repeat("x", 1022)+"\n", 17<<10)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, serve(h, http.MethodPost, "/write", big).Code)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(big))
+	gz.Close()
+	rec = serve(h, http.MethodPost, "/write", buf.String(), "Content-Encoding", "gzip")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/value/gauge/cpu_usage", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, serve(h, http.MethodPost, "/write", "cpu usage=1\n").Code)
+	assert.Equal(t, "1", serve(h, http.MethodGet, "/value/gauge/cpu_usage", "").Body.String())
+}
+
+func TestValidateConfigRuleSpecs(t *testing.T) {
+	cfg, err := config.LoadServerConfig([]string{"-type-rules", "*_total=histogram", "-forward", "ftp://dc1|["})
+	assert.NoError(t, err)
+	err = server.ValidateConfig(cfg)
+	assert.ErrorContains(t, err, "ingest_type_rules")
+	assert.ErrorContains(t, err, "forward_targets")
+
+	srv := server.New(&config.ServerConfig{StoreInterval: config.Duration(time.Hour)}, storage.New(), zerolog.Nop())
+	assert.Error(t, srv.Reload(cfg))
+
+	cfg, err = config.LoadServerConfig([]string{"-type-rules", "*_total=counter", "-forward", "http://dc1:8080|Alloc*"})
+	assert.NoError(t, err)
+	assert.NoError(t, server.ValidateConfig(cfg))
+}
+
+func TestLabelQueryParameters(t *testing.T) {
+	h := newTestHandler(t, nil)
+
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/gauge/load/1.5?label.host=a", "").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/gauge/load/2.5?label.host=b&debug=1", "").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/gauge/load/9", "").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/counter/hits/2?label.host=a", "").Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/counter/hits/3?label.host=a", "").Code)
+	assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodPost, "/update/gauge/load/1?label.bad-name=x", "").Code)
+
+	rec := serve(h, http.MethodGet, "/value/gauge/load?label.host=a", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1.5", rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/value/gauge/load?label.host=b", "")
+	assert.Equal(t, "2.5", rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/value/gauge/load?cache=no", "")
+	assert.Equal(t, "9", rec.Body.String())
+
+	rec = serve(h, http.MethodGet, "/value/counter/hits?label.host=a", "")
+	assert.Equal(t, "5", rec.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/value/gauge/load?label.host=c", "").Code)
+
+	rec = serve(h, http.MethodPost, "/value/", `{"id":"load","type":"gauge","labels":{"host":"b"}}`, "Content-Type", "application/json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"load","type":"gauge","value":2.5,"labels":{"host":"b"}}`, rec.Body.String())
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	h := server.RequestIDMiddleware(zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = server.RequestID(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "abc-123", seen)
+	assert.Equal(t, "abc-123", rec.Header().Get("X-Request-ID"))
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "bad id")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Len(t, seen, 32)
+	assert.Equal(t, seen, rec.Header().Get("X-Request-ID"))
+}
+
+func TestOTLPRejectsOversizedBody(t *testing.T) {
+	h := newTestHandler(t, nil)
+
+	body := strings.Repeat("x", 17<<20)
+	rec := serve(h, http.MethodPost, "/v1/metrics", body, "Content-Type", "application/x-protobuf")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(body))
+	gz.Close()
+	rec = serve(h, http.MethodPost, "/v1/metrics", buf.String(), "Content-Type", "application/x-protobuf", "Content-Encoding", "gzip")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+
+	rec = serve(h, http.MethodPost, "/v1/metrics", `{"resourceMetrics":[]}`, "Content-Type", "application/json")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAdminConfigReportsRuntimeLogLevel(t *testing.T) {
+	prev := logging.Level()
+	t.Cleanup(func() { logging.SetLevel(prev) })
+	assert.NoError(t, logging.SetLevel("info"))
+
+	h := newTestHandler(t, &config.ServerConfig{AdminToken: "secret", LogLevel: "info", LogSample: 1})
+	auth := []string{"Authorization", "Bearer secret", "Content-Type", "application/json"}
+
+	rec := serve(h, http.MethodPut, "/admin/log-level", `{"level":"debug"}`, auth...)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(h, http.MethodGet, "/admin/config", "", auth...)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var cfg config.ServerConfig
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cfg))
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, "[redacted]", cfg.AdminToken)
+}
+
+func TestHandlerErrorsAreLoggedWithRequestID(t *testing.T) {
+	var logs bytes.Buffer
+	cfg := &config.ServerConfig{AdminToken: "secret", LogSample: 1, StoreInterval: config.Duration(time.Hour)}
+	h := server.New(cfg, storage.New(), zerolog.New(&logs)).Handler()
+
+	lines := func(id string) string {
+		var matched []string
+		for _, line := range strings.Split(logs.String(), "\n") {
+			if strings.Contains(line, `"request_id":"`+id+`"`) {
+				matched = append(matched, line)
+			}
+		}
+		return strings.Join(matched, "\n")
+	}
+
+	serve(h, http.MethodPost, "/update/gauge/load/abc", "", "X-Request-ID", "req-1")
+	assert.Contains(t, lines("req-1"), "invalid gauge value")
+
+	serve(h, http.MethodPost, "/update/", `{"id":"load","type":"gauge"}`, "X-Request-ID", "req-2", "Content-Type", "application/json")
+	assert.Contains(t, lines("req-2"), "update rejected")
+
+	serve(h, http.MethodPost, "/update/", `{`, "X-Request-ID", "req-3", "Content-Type", "application/json")
+	assert.Contains(t, lines("req-3"), "invalid JSON request")
+
+	serve(h, http.MethodPost, "/update/gauge/load/1", "")
+	serve(h, http.MethodDelete, "/value/gauge/load", "", "X-Request-ID", "req-4", "Authorization", "Bearer secret")
+	assert.Contains(t, lines("req-4"), "metric deleted")
+}
+
+func TestAgentsStaleness(t *testing.T) {
+	h := newTestHandler(t, &config.ServerConfig{AgentStaleTimeout: config.Duration(50 * time.Millisecond)})
+
+	identity := []string{
+		"X-Agent-ID", "agent-1",
+		"X-Agent-Hostname", "host-a",
+		"X-Agent-Version", "1.2.3",
+		"X-Agent-Start-Time", "2024-01-02T03:04:05Z",
+	}
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/gauge/load/1?label.host=a", "", identity...).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/counter/hits/1", "", identity...).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/gauge/anonymous/1", "").Code)
+
+	listAgents := func() []map[string]any {
+		rec := serve(h, http.MethodGet, "/agents", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var agents []map[string]any
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &agents))
+		return agents
+	}
+
+	agents := listAgents()
+	if assert.Len(t, agents, 1) {
+		assert.Equal(t, "agent-1", agents[0]["id"])
+		assert.Equal(t, "host-a", agents[0]["hostname"])
+		assert.Equal(t, "1.2.3", agents[0]["version"])
+		assert.Equal(t, "2024-01-02T03:04:05Z", agents[0]["start_time"])
+		assert.Equal(t, []any{"hits", `load{host="a"}`}, agents[0]["metrics"])
+		assert.Equal(t, false, agents[0]["stale"])
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	agents = listAgents()
+	if assert.Len(t, agents, 1) {
+		assert.Equal(t, true, agents[0]["stale"])
+	}
+
+	serve(h, http.MethodPost, "/update/gauge/load/2", "", identity...)
+	agents = listAgents()
+	if assert.Len(t, agents, 1) {
+		assert.Equal(t, false, agents[0]["stale"])
+	}
+
+	// The registry is capped, forgetting the least recently seen entries.
+	for i := range 1100 {
+		serve(h, http.MethodPost, fmt.Sprintf("/update/gauge/load/1?label.n=%d", i), "", identity...)
+	}
+	for i := range 1000 {
+		serve(h, http.MethodPost, "/update/gauge/load/1", "", "X-Agent-ID", fmt.Sprintf("agent-%d", i+2))
+	}
+	agents = listAgents()
+	assert.Len(t, agents, 1000)
+	for _, agent := range agents {
+		assert.NotEqual(t, "agent-1", agent["id"])
+	}
+
+	h = newTestHandler(t, nil)
+	for i := range 1100 {
+		serve(h, http.MethodPost, fmt.Sprintf("/update/gauge/load/1?label.n=%d", i), "", identity...)
+	}
+	agents = listAgents()
+	if assert.Len(t, agents, 1) {
+		assert.Len(t, agents[0]["metrics"], 1000)
+		assert.NotContains(t, agents[0]["metrics"], `load{n="0"}`)
+		assert.Contains(t, agents[0]["metrics"], `load{n="1099"}`)
+	}
+}
+
+func TestDeleteAndResetAuthorization(t *testing.T) {
+	disabled := newTestHandler(t, nil)
+	assert.Equal(t, http.StatusForbidden, serve(disabled, http.MethodDelete, "/value/gauge/load", "", "Authorization", "Bearer secret").Code)
+
+	h := newTestHandler(t, &config.ServerConfig{AdminToken: "secret"})
+	serve(h, http.MethodPost, "/update/gauge/load/1", "")
+	serve(h, http.MethodPost, "/update/counter/hits/5?label.host=a", "")
+
+	for _, header := range [][]string{nil, {"Authorization", "Bearer wrong"}, {"Authorization", "secret"}} {
+		rec := serve(h, http.MethodDelete, "/value/gauge/load", "", header...)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodPost, "/reset/counter/hits?label.host=a", "", header...).Code)
+	}
+
+	auth := []string{"Authorization", "Bearer secret"}
+	assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodDelete, "/value/histogram/load", "", auth...).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodDelete, "/value/gauge/load", "", auth...).Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodDelete, "/value/gauge/load", "", auth...).Code)
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/value/gauge/load", "").Code)
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodPost, "/reset/counter/hits", "", auth...).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/reset/counter/hits?label.host=a", "", auth...).Code)
+	assert.Equal(t, "0", serve(h, http.MethodGet, "/value/counter/hits?label.host=a", "").Body.String())
+}
+
+func TestDeleteAndResetArePersistedPublishedAndForwarded(t *testing.T) {
+	var mu sync.Mutex
+	var upstream []string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/update/" {
+			mu.Lock()
+			upstream = append(upstream, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("Authorization"))
+			mu.Unlock()
+		}
+	}))
+	defer up.Close()
+
+	targets, err := forward.ParseTargets("http://:uptoken@" + strings.TrimPrefix(up.URL, "http://"))
+	assert.NoError(t, err)
+	fw, err := forward.New(targets, "", zerolog.Nop())
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fw.Run(ctx)
+
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	cfg := &config.ServerConfig{AdminToken: "secret", StoreInterval: config.Duration(time.Hour)}
+	srv := server.New(cfg, storage.NewWithFile(path), zerolog.Nop())
+	srv.SetForwarder(fw)
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	h := srv.Handler()
+	auth := []string{"Authorization", "Bearer secret"}
+	serve(h, http.MethodPost, "/update/gauge/load/1", "")
+	serve(h, http.MethodPost, "/update/counter/hits/5?label.host=a", "")
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodDelete, "/value/gauge/load", "", auth...).Code)
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/reset/counter/hits?label.host=a", "", auth...).Code)
+
+	// Saved right away even though the store interval is an hour.
+	saved := storage.NewWithFile(path)
+	assert.NoError(t, saved.LoadFromFile())
+	gauges, counters := saved.GetAll()
+	assert.NotContains(t, gauges, "load")
+	assert.Equal(t, int64(0), counters[`hits{host="a"}`])
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "2")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	events := bufio.NewReader(resp.Body)
+	var kinds []string
+	for len(kinds) < 2 {
+		line, err := events.ReadString('\n')
+		if !assert.NoError(t, err) {
+			break
+		}
+		if kind, ok := strings.CutPrefix(strings.TrimSpace(line), "event: "); ok {
+			kinds = append(kinds, kind)
+		}
+	}
+	assert.Equal(t, []string{"delete", "reset"}, kinds)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(upstream) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{
+		"DELETE /value/gauge/load Bearer uptoken",
+		"POST /reset/counter/hits?label.host=a Bearer uptoken",
+	}, upstream)
+}
+
+func TestBulkDeleteByPattern(t *testing.T) {
+	h := newTestHandler(t, &config.ServerConfig{AdminToken: "secret"})
+	for _, target := range []string{
+		"/update/gauge/cpu_user/1?label.host=a",
+		"/update/gauge/cpu_user/2?label.host=b",
+		"/update/gauge/cpu_system/3?label.host=a",
+		"/update/counter/cpu_ticks/4?label.host=a",
+		"/update/gauge/mem_free/5?label.host=a",
+	} {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, target, "").Code)
+	}
+
+	auth := []string{"Authorization", "Bearer secret", "Content-Type", "application/json"}
+
+	rec := serve(h, http.MethodDelete, "/value/", `[{"id":"["}]`, auth...)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = serve(h, http.MethodDelete, "/value/", `[{"id":"cpu_*","type":"summary"}]`, auth...)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(h, http.MethodDelete, "/value/", `[{"id":"cpu_*","type":"gauge","labels":{"host":"a"}}]`, auth...)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[
+		{"id":"cpu_system","type":"gauge","labels":{"host":"a"}},
+		{"id":"cpu_user","type":"gauge","labels":{"host":"a"}}
+	]`, rec.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, serve(h, http.MethodGet, "/value/gauge/cpu_user?label.host=a", "").Code)
+	assert.Equal(t, "2", serve(h, http.MethodGet, "/value/gauge/cpu_user?label.host=b", "").Body.String())
+	assert.Equal(t, "4", serve(h, http.MethodGet, "/value/counter/cpu_ticks?label.host=a", "").Body.String())
+	assert.Equal(t, "5", serve(h, http.MethodGet, "/value/gauge/mem_free?label.host=a", "").Body.String())
+
+	rec = serve(h, http.MethodDelete, "/value/", `[{"id":"nothing*"}]`, auth...)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+}
+
+func TestListMetricsFilterPaginationAndETag(t *testing.T) {
+	h := newTestHandler(t, nil)
+	for _, target := range []string{
+		"/update/gauge/cpu_user/3?label.host=a",
+		"/update/gauge/cpu_user/1?label.host=b",
+		"/update/gauge/cpu_system/2?label.host=a",
+		"/update/counter/cpu_ticks/7?label.host=a",
+		"/update/gauge/mem_free/5",
+	} {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, target, "").Code)
+	}
+
+	ids := func(rec *httptest.ResponseRecorder) []string {
+		var metrics []models.Metrics
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &metrics))
+		result := make([]string, 0, len(metrics))
+		for _, m := range metrics {
+			result = append(result, labels.Key(m.ID, m.Labels))
+		}
+		return result
+	}
+
+	rec := serve(h, http.MethodGet, "/api/metrics?prefix=cpu_&type=gauge&match=host=a", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Total-Count"))
+	assert.Equal(t, []string{`cpu_system{host="a"}`, `cpu_user{host="a"}`}, ids(rec))
+
+	rec = serve(h, http.MethodGet, "/api/metrics?glob=cpu_*&match=host!=a", "")
+	assert.Equal(t, []string{`cpu_user{host="b"}`}, ids(rec))
+
+	rec = serve(h, http.MethodGet, "/api/metrics?regex=^(mem|cpu_t)", "")
+	assert.Equal(t, []string{`cpu_ticks{host="a"}`, "mem_free"}, ids(rec))
+
+	rec = serve(h, http.MethodGet, "/api/metrics?sort=-value&limit=2", "")
+	assert.Equal(t, "5", rec.Header().Get("X-Total-Count"))
+	assert.Equal(t, []string{`cpu_ticks{host="a"}`, "mem_free"}, ids(rec))
+	cursor := rec.Header().Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor)
+
+	rec = serve(h, http.MethodGet, "/api/metrics?sort=-value&limit=2&cursor="+cursor, "")
+	assert.Equal(t, []string{`cpu_user{host="a"}`, `cpu_system{host="a"}`}, ids(rec))
+	cursor = rec.Header().Get("X-Next-Cursor")
+
+	rec = serve(h, http.MethodGet, "/api/metrics?sort=-value&limit=2&cursor="+cursor, "")
+	assert.Equal(t, []string{`cpu_user{host="b"}`}, ids(rec))
+	assert.Empty(t, rec.Header().Get("X-Next-Cursor"))
+
+	for _, query := range []string{"type=histogram", "glob=[", "regex=(", "match=host", "sort=size", "limit=-1", "cursor=%21"} {
+		assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodGet, "/api/metrics?"+query, "").Code, query)
+	}
+
+	rec = serve(h, http.MethodGet, "/api/metrics", "")
+	etag := rec.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	rec = serve(h, http.MethodGet, "/api/metrics", "", "If-None-Match", `"other", W/`+etag)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Empty(t, rec.Body.String())
+
+	serve(h, http.MethodPost, "/update/gauge/mem_free/6", "")
+	rec = serve(h, http.MethodGet, "/api/metrics", "", "If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestDashboardEscapesAndFilters(t *testing.T) {
+	h := newTestHandler(t, nil)
+	for _, body := range []string{
+		`{"id":"<script>alert(1)</script>","type":"gauge","value":1}`,
+		`{"id":"mem_free","type":"gauge","value":2,"labels":{"host":"<b>a</b>"}}`,
+		`{"id":"cpu_load","type":"gauge","value":3}`,
+		`{"id":"requests","type":"counter","delta":4}`,
+	} {
+		assert.Equal(t, http.StatusOK, serve(h, http.MethodPost, "/update/", body, "Content-Type", "application/json").Code)
+	}
+
+	rec := serve(h, http.MethodGet, "/?q=%22%3E%3Cscript%3E", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), `"><script>`)
+
+	body := serve(h, http.MethodGet, "/", "").Body.String()
+	assert.NotContains(t, body, "<script>alert(1)</script>")
+	assert.Contains(t, body, "&lt;script&gt;alert(1)&lt;/script&gt;")
+	assert.NotContains(t, body, "<b>a</b>")
+	assert.Contains(t, body, "host=&lt;b&gt;a&lt;/b&gt;")
+
+	// Rows are sorted by name within each section.
+	cpu := strings.Index(body, "<td>cpu_load</td>")
+	mem := strings.Index(body, "<td>mem_free</td>")
+	script := strings.Index(body, "<td>&lt;script&gt;")
+	requests := strings.Index(body, "<td>requests</td>")
+	assert.True(t, script < cpu && cpu < mem && mem < requests, "unexpected row order")
+
+	// The search matches the series key case-insensitively.
+	body = serve(h, http.MethodGet, "/?q=CPU", "").Body.String()
+	assert.Contains(t, body, "<td>cpu_load</td>")
+	assert.NotContains(t, body, "<td>mem_free</td>")
+	assert.NotContains(t, body, "<td>requests</td>")
+
+	body = serve(h, http.MethodGet, "/?q=host%3D%22%3Cb", "").Body.String()
+	assert.Contains(t, body, "<td>mem_free</td>")
+	assert.NotContains(t, body, "<td>cpu_load</td>")
+
+	assert.Equal(t, http.StatusBadRequest, serve(h, http.MethodGet, "/?refresh=-1", "").Code)
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	ts := httptest.NewServer(newTestHandler(t, nil))
+	defer ts.Close()
+
+	post := func(target string) {
+		resp, err := http.Post(ts.URL+target, "text/plain", nil)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	post("/update/gauge/cpu/1")
+	post("/update/gauge/mem/2")
+	post("/update/gauge/cpu/3")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/stream?prefix=cpu", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "1")
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(resp.Body)
+	next := func() (string, models.Metrics) {
+		var id string
+		var m models.Metrics
+		for {
+			line, err := events.ReadString('\n')
+			if !assert.NoError(t, err) {
+				return "", m
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "data: "):
+				assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &m))
+			case line == "" && id != "":
+				return id, m
+			}
+		}
+	}
+
+	// Event 2 is filtered out, so the backlog only replays event 3.
+	id, m := next()
+	assert.Equal(t, "3", id)
+	assert.Equal(t, "cpu", m.ID)
+	assert.Equal(t, 3.0, *m.Value)
+
+	post("/update/gauge/mem/4")
+	post("/update/gauge/cpu/5")
+	id, m = next()
+	assert.Equal(t, "5", id)
+	assert.Equal(t, 5.0, *m.Value)
+
+	assert.Equal(t, http.StatusBadRequest, serve(newTestHandler(t, nil), http.MethodGet, "/stream", "", "Last-Event-ID", "x").Code)
+}
+
+func TestReloadMergesConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	write := func(body string) {
+		assert.NoError(t, os.WriteFile(path, []byte(body), 0600))
+	}
+	write("address: localhost:8081\nadmin_token: secret\nstore_interval: 1h\nfile_storage_path: ''\n")
+
+	args := []string{"-c", path}
+	cfg, err := config.LoadServerConfig(args)
+	assert.NoError(t, err)
+	srv := server.New(cfg, storage.New(), zerolog.Nop())
+	h := srv.Handler()
+
+	write("address: localhost:9090\nadmin_token: rotated\nstore_interval: 30m\nfile_storage_path: ''\ningest_type_rules: '*_total=counter'\n")
+	next, err := config.LoadServerConfig(args)
+	assert.NoError(t, err)
+
+	merged, rejected := cfg.MergeReload(next)
+	assert.Equal(t, []string{"address"}, rejected)
+	assert.Equal(t, "localhost:8081", merged.Address)
+	assert.Equal(t, config.Duration(30*time.Minute), merged.StoreInterval)
+	assert.Equal(t, "localhost:9090", next.Address)
+
+	assert.NoError(t, srv.Reload(next))
+
+	assert.Equal(t, http.StatusUnauthorized, serve(h, http.MethodGet, "/admin/config", "", "Authorization", "Bearer secret").Code)
+	rec := serve(h, http.MethodGet, "/admin/config", "", "Authorization", "Bearer rotated")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var effective map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &effective))
+	assert.Equal(t, "localhost:8081", effective["address"])
+	assert.Equal(t, "30m0s", effective["store_interval"])
+
+	assert.Equal(t, http.StatusNoContent, serve(h, http.MethodPost, "/write", "requests_total value=3i\n").Code)
+	assert.Equal(t, "3", serve(h, http.MethodGet, "/value/counter/requests_total", "").Body.String())
+
+	// A config that fails validation is rejected as a whole.
+	write("address: localhost:8081\nadmin_token: other\nstore_interval: -1s\n")
+	_, err = config.LoadServerConfig(args)
+	assert.ErrorContains(t, err, "store_interval")
+	assert.Equal(t, http.StatusOK, serve(h, http.MethodGet, "/admin/config", "", "Authorization", "Bearer rotated").Code)
+}
+
+func TestReloadDoesNotWaitForStoreLoop(t *testing.T) {
+	srv := server.New(&config.ServerConfig{StoreInterval: config.Duration(time.Hour)}, storage.New(), zerolog.Nop())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, d := range []time.Duration{time.Minute, 2 * time.Minute, 0} {
+			assert.NoError(t, srv.Reload(&config.ServerConfig{StoreInterval: config.Duration(d)}))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reload blocked on the store interval")
+	}
+}
+
+type wsMessage struct {
+	Type     string           `json:"type"`
+	Patterns []string         `json:"patterns,omitempty"`
+	EventID  uint64           `json:"event_id,omitempty"`
+	Metric   *models.Metrics  `json:"metric,omitempty"`
+	Metrics  []models.Metrics `json:"metrics,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// newWSServer serves the server's handler and closes the returned channel
+// once the websocket handler has returned.
+func newWSServer(t *testing.T) (*server.Server, *websocket.Conn, <-chan struct{}) {
+	t.Helper()
+
+	srv := server.New(&config.ServerConfig{StoreInterval: config.Duration(time.Hour)}, storage.New(), zerolog.Nop())
+	h := srv.Handler()
+	exited := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			defer close(exited)
+		}
+		h.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http")+"/ws", nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, conn, exited
+}
+
+func readWS(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	assert.NoError(t, conn.ReadJSON(&msg))
+	return msg
+}
+
+func waitExited(t *testing.T, exited <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("websocket handler did not return")
+	}
+}
+
+func TestWebsocketProtocol(t *testing.T) {
+	srv, conn, exited := newWSServer(t)
+
+	_, err := srv.Apply(models.Gauge("cpu_load", 1.5, nil))
+	assert.NoError(t, err)
+
+	assert.NoError(t, conn.WriteJSON(wsMessage{Type: "subscribe", Patterns: []string{"cpu_*", "["}}))
+	msg := readWS(t, conn)
+	assert.Equal(t, "error", msg.Type)
+	assert.Contains(t, msg.Error, "invalid pattern")
+	msg = readWS(t, conn)
+	assert.Equal(t, "subscribed", msg.Type)
+	assert.Equal(t, []string{"cpu_*"}, msg.Patterns)
+
+	assert.NoError(t, conn.WriteJSON(wsMessage{Type: "snapshot"}))
+	msg = readWS(t, conn)
+	assert.Equal(t, "snapshot", msg.Type)
+	if assert.Len(t, msg.Metrics, 1) {
+		assert.Equal(t, "cpu_load", msg.Metrics[0].ID)
+	}
+
+	_, err = srv.Apply(models.Counter("mem_pages", 3, nil))
+	assert.NoError(t, err)
+	_, err = srv.Apply(models.Gauge("cpu_load", 1.5, nil))
+	assert.NoError(t, err)
+
+	msg = readWS(t, conn)
+	assert.Equal(t, "update", msg.Type)
+	assert.NotZero(t, msg.EventID)
+	if assert.NotNil(t, msg.Metric) {
+		assert.Equal(t, "cpu_load", msg.Metric.ID)
+	}
+
+	assert.NoError(t, conn.WriteJSON(wsMessage{Type: "bogus"}))
+	msg = readWS(t, conn)
+	assert.Equal(t, "error", msg.Type)
+
+	conn.Close()
+	waitExited(t, exited)
+}
+
+func TestWebsocketSlowSubscriberDisconnect(t *testing.T) {
+	srv, conn, exited := newWSServer(t)
+
+	assert.NoError(t, conn.WriteJSON(wsMessage{Type: "subscribe", Patterns: []string{"*"}}))
+	assert.Equal(t, "subscribed", readWS(t, conn).Type)
+
+	// Without reading, the socket buffers fill up, the writer blocks and the
+	// subscriber queue overflows, so the hub drops the subscriber.
+	padding := map[string]string{"padding": strings.Repeat("x", 4096)}
+	for i := 0; i < 10000; i++ {
+		_, err := srv.Apply(models.Gauge("load", float64(i), padding))
+		assert.NoError(t, err)
+	}
+
+	var closeErr *websocket.CloseError
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg wsMessage
+		err := conn.ReadJSON(&msg)
+		if err == nil {
+			continue
+		}
+		if !assert.ErrorAs(t, err, &closeErr) {
+			return
+		}
+		break
+	}
+	assert.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+
+	// Requests sent after the writer exited must not block the handler.
+	for i := 0; i < 100; i++ {
+		if conn.WriteJSON(wsMessage{Type: "snapshot"}) != nil {
+			break
+		}
+	}
+	waitExited(t, exited)
+}
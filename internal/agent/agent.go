@@ -3,62 +3,512 @@ package agent
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"net/http"
-	"runtime"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/alex19451/httpserver/internal/collector"
 	"github.com/alex19451/httpserver/internal/config"
+	"github.com/alex19451/httpserver/internal/labels"
 	"github.com/alex19451/httpserver/internal/models"
 	"github.com/rs/zerolog"
 )
 
+var Version = "dev"
+
+var errRejected = errors.New("metric rejected by server")
+
 type Agent struct {
-	cfg    *config.AgentConfig
-	logger zerolog.Logger
+	cfg       atomic.Pointer[config.AgentConfig]
+	logger    zerolog.Logger
+	hostname  string
+	id        string
+	startTime time.Time
+	reloaded  chan struct{}
+
+	mu         sync.Mutex
+	polls      int64
+	collectors []collector.Collector
+	aggregates []aggregateRule
+	pending    map[string]models.Metrics
+	totals     map[string]models.Metrics
+	window     map[string][]windowSample
+}
+
+func New(cfg *config.AgentConfig, logger zerolog.Logger) (*Agent, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to resolve hostname")
+		hostname = "unknown"
+	}
+
+	id := cfg.AgentID
+	if id == "" {
+		id = hostname
+	}
+
+	if err := ValidateConfig(cfg); err != nil {
+		return nil, err
+	}
+	collectors, err := buildCollectors(nil, nil, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	aggregates, err := parseAggregateRules(cfg.AggregateRules)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Agent{
+		logger:     logger,
+		hostname:   hostname,
+		id:         id,
+		startTime:  time.Now(),
+		reloaded:   make(chan struct{}, 1),
+		collectors: collectors,
+		aggregates: aggregates,
+		pending:    make(map[string]models.Metrics),
+		totals:     make(map[string]models.Metrics),
+		window:     make(map[string][]windowSample),
+	}
+	a.cfg.Store(cfg)
+	return a, nil
+}
+
+func (a *Agent) config() *config.AgentConfig {
+	return a.cfg.Load()
+}
+
+// Reload applies a new config to the running agent without dropping metrics
+// that have not been reported yet. Settings that need a restart keep their
+// current values and are logged.
+func (a *Agent) Reload(next *config.AgentConfig) error {
+	if err := ValidateConfig(next); err != nil {
+		return err
+	}
+	cur := a.config()
+	merged, rejected := cur.MergeReload(next)
+
+	aggregates, err := parseAggregateRules(merged.AggregateRules)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	current := a.collectors
+	a.mu.Unlock()
+
+	collectors, err := buildCollectors(current, cur, merged)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.collectors = collectors
+	a.aggregates = aggregates
+	a.mu.Unlock()
+	a.cfg.Store(merged)
+
+	var replaced []collector.Collector
+	rebuilt := 0
+	for i, c := range collectors {
+		if c == current[i] {
+			continue
+		}
+		rebuilt++
+		if current[i] != nil {
+			replaced = append(replaced, current[i])
+		}
+	}
+	closeCollectors(replaced)
+
+	select {
+	case a.reloaded <- struct{}{}:
+	default:
+	}
+
+	for _, name := range rejected {
+		a.logger.Warn().Str("setting", name).Msg("setting cannot change at runtime, restart to apply it")
+	}
+	a.logger.Info().
+		Dur("poll_interval", time.Duration(merged.PollInterval)).
+		Dur("report_interval", time.Duration(merged.ReportInterval)).
+		Int("collectors_rebuilt", rebuilt).
+		Int("rejected", len(rejected)).
+		Msg("config reloaded")
+	return nil
+}
+
+// ValidateConfig checks the rule and collector specs in cfg, which the
+// config package leaves to the agent since it owns their parsers.
+func ValidateConfig(cfg *config.AgentConfig) error {
+	var errs []error
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	_, err := parseAggregateRules(cfg.AggregateRules)
+	check("aggregate_rules", err)
+	_, err = collector.ParseRenameRules(cfg.PromRename)
+	check("prom_rename", err)
+	if cfg.ExecCommands != "" {
+		_, err = collector.ParseExecCommands(cfg.ExecCommands)
+		check("exec_commands", err)
+	}
+	if cfg.LogRules != "" {
+		_, err = collector.ParseLogRules(cfg.LogRules)
+		check("logtail_rules", err)
+	}
+	if cfg.ProcessSelectors != "" {
+		_, err = collector.ParseProcessSelectors(cfg.ProcessSelectors)
+		check("process_selectors", err)
+	}
+	return errors.Join(errs...)
+}
+
+func splitList(spec string) []string {
+	var items []string
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// collectorKind describes one kind of collector: the settings it is built
+// from and how to build it. build returns nil when the kind is disabled.
+type collectorKind struct {
+	settings func(cfg *config.AgentConfig) any
+	build    func(cfg *config.AgentConfig) (collector.Collector, error)
+}
+
+type promSettings struct {
+	urls, drop, rename string
+	flatten            bool
+}
+
+type execSettings struct {
+	commands string
+	timeout  config.Duration
+}
+
+type logSettings struct {
+	rules, statePath string
+}
+
+// collectorKinds lists the collectors in poll order.
+var collectorKinds = []collectorKind{
+	{
+		settings: func(cfg *config.AgentConfig) any { return cfg.RuntimeProfile },
+		build:    buildRuntime,
+	},
+	{
+		settings: func(cfg *config.AgentConfig) any {
+			return promSettings{cfg.PromURLs, cfg.PromDrop, cfg.PromRename, cfg.PromFlattenLabels}
+		},
+		build: buildPrometheus,
+	},
+	{
+		settings: func(cfg *config.AgentConfig) any { return execSettings{cfg.ExecCommands, cfg.ExecTimeout} },
+		build:    buildExec,
+	},
+	{
+		settings: func(cfg *config.AgentConfig) any { return logSettings{cfg.LogRules, cfg.LogStatePath} },
+		build:    buildLogTail,
+	},
+	{
+		settings: func(cfg *config.AgentConfig) any { return cfg.ProcessSelectors },
+		build:    buildProcess,
+	},
+}
+
+// buildCollectors returns one slot per collector kind, nil for disabled
+// kinds. Kinds whose settings are the same in prev and next keep their
+// collector from cur, so counter baselines and other state survive a reload.
+func buildCollectors(cur []collector.Collector, prev, next *config.AgentConfig) ([]collector.Collector, error) {
+	collectors := make([]collector.Collector, len(collectorKinds))
+	for i, kind := range collectorKinds {
+		if prev != nil && kind.settings(prev) == kind.settings(next) {
+			collectors[i] = cur[i]
+			continue
+		}
+		c, err := kind.build(next)
+		if err != nil {
+			return nil, err
+		}
+		collectors[i] = c
+	}
+	return collectors, nil
+}
+
+func buildRuntime(cfg *config.AgentConfig) (collector.Collector, error) {
+	switch cfg.RuntimeProfile {
+	case "memstats":
+		return collector.NewRuntime(), nil
+	case "metrics":
+		return collector.NewRuntimeMetrics(), nil
+	}
+	return nil, fmt.Errorf("unknown runtime profile %q", cfg.RuntimeProfile)
+}
+
+func buildPrometheus(cfg *config.AgentConfig) (collector.Collector, error) {
+	urls := splitList(cfg.PromURLs)
+	if len(urls) == 0 {
+		return nil, nil
+	}
+	rename, err := collector.ParseRenameRules(cfg.PromRename)
+	if err != nil {
+		return nil, err
+	}
+	return collector.NewPrometheus(collector.PrometheusConfig{
+		URLs:          urls,
+		Drop:          splitList(cfg.PromDrop),
+		Rename:        rename,
+		FlattenLabels: cfg.PromFlattenLabels,
+		Timeout:       5 * time.Second,
+	}), nil
 }
 
-func New(cfg *config.AgentConfig, logger zerolog.Logger) *Agent {
-	return &Agent{
-		cfg:    cfg,
-		logger: logger,
+func buildExec(cfg *config.AgentConfig) (collector.Collector, error) {
+	if cfg.ExecCommands == "" {
+		return nil, nil
+	}
+	commands, err := collector.ParseExecCommands(cfg.ExecCommands)
+	if err != nil {
+		return nil, err
+	}
+	return collector.NewExec(commands, time.Duration(cfg.ExecTimeout)), nil
+}
+
+func buildLogTail(cfg *config.AgentConfig) (collector.Collector, error) {
+	if cfg.LogRules == "" {
+		return nil, nil
+	}
+	rules, err := collector.ParseLogRules(cfg.LogRules)
+	if err != nil {
+		return nil, err
+	}
+	return collector.NewLogTail(rules, cfg.LogStatePath)
+}
+
+func buildProcess(cfg *config.AgentConfig) (collector.Collector, error) {
+	if cfg.ProcessSelectors == "" {
+		return nil, nil
+	}
+	selectors, err := collector.ParseProcessSelectors(cfg.ProcessSelectors)
+	if err != nil {
+		return nil, err
+	}
+	return collector.NewProcess(selectors), nil
+}
+
+// closeCollectors releases collectors that hold resources between polls.
+func closeCollectors(collectors []collector.Collector) {
+	for _, c := range collectors {
+		if closer, ok := c.(io.Closer); ok {
+			closer.Close()
+		}
 	}
 }
 
 func (a *Agent) Run() {
-	pollInterval := time.Duration(a.cfg.PollInterval) * time.Second
-	reportInterval := time.Duration(a.cfg.ReportInterval) * time.Second
+	cfg := a.config()
+	a.mu.Lock()
+	enabled := 0
+	for _, c := range a.collectors {
+		if c != nil {
+			enabled++
+		}
+	}
+	a.mu.Unlock()
+
+	pollInterval := time.Duration(cfg.PollInterval)
+	reportInterval := time.Duration(cfg.ReportInterval)
 
 	a.logger.Info().
-		Str("address", a.cfg.Address).
+		Str("address", cfg.Address).
+		Str("agent_id", a.id).
+		Str("hostname", a.hostname).
+		Str("version", Version).
 		Dur("poll_interval", pollInterval).
 		Dur("report_interval", reportInterval).
+		Int("collectors", enabled).
 		Msg("agent started")
 
-	count := 0
+	if cfg.ListenAddress != "" {
+		go a.serve()
+	}
+	if cfg.GatewayAddress != "" {
+		go a.serveGateway()
+	}
+
 	pollTicker := time.NewTicker(pollInterval)
 	reportTicker := time.NewTicker(reportInterval)
 	defer pollTicker.Stop()
 	defer reportTicker.Stop()
 
-	var mem runtime.MemStats
-
 	for {
 		select {
 		case <-pollTicker.C:
-			count++
-			runtime.ReadMemStats(&mem)
+			a.poll(context.Background())
 
 		case <-reportTicker.C:
 			a.logger.Info().Msg("sending metrics")
-			a.sendAllWithBackoff(count, mem)
+			a.report()
+
+		case <-a.reloaded:
+			cfg := a.config()
+			pollTicker.Reset(time.Duration(cfg.PollInterval))
+			reportTicker.Reset(time.Duration(cfg.ReportInterval))
+		}
+	}
+}
+
+func (a *Agent) poll(ctx context.Context) {
+	a.mu.Lock()
+	a.polls++
+	collectors := a.collectors
+	a.mu.Unlock()
+
+	for _, c := range collectors {
+		if c == nil {
+			continue
+		}
+		metrics, err := c.Collect(ctx)
+		if err != nil {
+			a.logger.Warn().Err(err).Str("collector", c.Name()).Msg("collector failed")
 		}
+		a.record(metrics)
 	}
 }
 
-func (a *Agent) sendAllWithBackoff(pollCount int, mem runtime.MemStats) {
+func metricKey(m models.Metrics) string {
+	return m.MType + ":" + labels.Key(m.ID, m.Labels)
+}
+
+func (a *Agent) withHostLabels(m models.Metrics) models.Metrics {
+	if !a.config().HostLabel {
+		return m
+	}
+	ls := make(map[string]string, len(m.Labels)+2)
+	for k, v := range m.Labels {
+		ls[k] = v
+	}
+	ls["host"] = a.hostname
+	ls["agent"] = a.id
+	m.Labels = ls
+	return m
+}
+
+func (a *Agent) record(metrics []models.Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, m := range metrics {
+		m = a.withHostLabels(m)
+		key := metricKey(m)
+
+		if m.MType != "counter" || m.Delta == nil {
+			a.pending[key] = m
+			a.totals[key] = m
+			a.observe(key, m)
+			continue
+		}
+
+		a.pending[key] = addDelta(a.pending[key], m, *m.Delta)
+		a.totals[key] = addDelta(a.totals[key], m, *m.Delta)
+	}
+}
+
+func addDelta(prev, m models.Metrics, delta int64) models.Metrics {
+	if prev.Delta != nil {
+		delta += *prev.Delta
+	}
+	m.Delta = &delta
+	return m
+}
+
+func sortedMetrics(set map[string]models.Metrics) []models.Metrics {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]models.Metrics, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, set[k])
+	}
+	return result
+}
+
+// withPollCount prepends PollCount, which carries the number of polls since
+// the agent started and is resent in full on every report. The caller must
+// hold a.mu.
+func (a *Agent) withPollCount(metrics []models.Metrics) []models.Metrics {
+	if a.polls == 0 {
+		return metrics
+	}
+	count := a.polls
+	pollCount := a.withHostLabels(models.Metrics{ID: "PollCount", MType: "counter", Delta: &count})
+	return append([]models.Metrics{pollCount}, metrics...)
+}
+
+func (a *Agent) snapshot() []models.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.withPollCount(sortedMetrics(a.totals))
+}
+
+func (a *Agent) ack(sent []models.Metrics) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, m := range sent {
+		if m.MType != "counter" || m.Delta == nil {
+			continue
+		}
+		key := metricKey(m)
+		rest := a.pending[key]
+		if rest.Delta == nil {
+			continue
+		}
+
+		left := *rest.Delta - *m.Delta
+		if left == 0 {
+			delete(a.pending, key)
+			continue
+		}
+		rest.Delta = &left
+		a.pending[key] = rest
+	}
+}
+
+func (a *Agent) report() {
+	a.mu.Lock()
+	a.flushWindow()
+	metrics := a.withPollCount(sortedMetrics(a.pending))
+	a.mu.Unlock()
+
+	a.sendAllWithBackoff(metrics)
+}
+
+func (a *Agent) sendAllWithBackoff(metrics []models.Metrics) {
 	backoffSchedule := []time.Duration{
 		100 * time.Millisecond,
 		500 * time.Millisecond,
@@ -66,10 +516,14 @@ func (a *Agent) sendAllWithBackoff(pollCount int, mem runtime.MemStats) {
 	}
 
 	for _, backoff := range backoffSchedule {
-		if err := a.sendAll(pollCount, mem); err == nil {
+		sent, err := a.sendAll(metrics)
+		a.ack(metrics[:sent])
+		metrics = metrics[sent:]
+		if err == nil {
 			return
 		}
 		a.logger.Warn().
+			Err(err).
 			Dur("backoff", backoff).
 			Msg("failed to send metrics, retrying")
 		time.Sleep(backoff)
@@ -77,70 +531,60 @@ func (a *Agent) sendAllWithBackoff(pollCount int, mem runtime.MemStats) {
 	a.logger.Error().Msg("failed to send metrics after all retries")
 }
 
-func (a *Agent) sendAll(pollCount int, mem runtime.MemStats) error {
-	pollCountValue := int64(pollCount)
-	if err := a.sendJSON("counter", "PollCount", &pollCountValue, nil); err != nil {
-		return err
+// sendAll sends metrics in order and returns how many were handled before the
+// first transport or server error. Metrics the server rejects as invalid are
+// dropped so they cannot hold back the rest of the batch.
+func (a *Agent) sendAll(metrics []models.Metrics) (int, error) {
+	for i, m := range metrics {
+		err := a.sendJSON(m)
+		if errors.Is(err, errRejected) {
+			a.logger.Warn().Err(err).Msg("server rejected metric, dropping it")
+			a.drop(m)
+			continue
+		}
+		if err != nil {
+			return i, err
+		}
 	}
+	return len(metrics), nil
+}
 
-	randomValue := rand.Float64()
-	if err := a.sendJSON("gauge", "RandomValue", nil, &randomValue); err != nil {
-		return err
+// drop forgets a rejected metric. Counter deltas are acked like sent ones so
+// later increments survive; gauges are removed until the next poll.
+func (a *Agent) drop(m models.Metrics) {
+	if m.MType == "counter" {
+		a.ack([]models.Metrics{m})
+		return
 	}
 
-	runtimeMetrics := map[string]float64{
-		"Alloc":         float64(mem.Alloc),
-		"BuckHashSys":   float64(mem.BuckHashSys),
-		"Frees":         float64(mem.Frees),
-		"GCCPUFraction": mem.GCCPUFraction,
-		"GCSys":         float64(mem.GCSys),
-		"HeapAlloc":     float64(mem.HeapAlloc),
-		"HeapIdle":      float64(mem.HeapIdle),
-		"HeapInuse":     float64(mem.HeapInuse),
-		"HeapObjects":   float64(mem.HeapObjects),
-		"HeapReleased":  float64(mem.HeapReleased),
-		"HeapSys":       float64(mem.HeapSys),
-		"LastGC":        float64(mem.LastGC),
-		"Lookups":       float64(mem.Lookups),
-		"MCacheInuse":   float64(mem.MCacheInuse),
-		"MCacheSys":     float64(mem.MCacheSys),
-		"MSpanInuse":    float64(mem.MSpanInuse),
-		"MSpanSys":      float64(mem.MSpanSys),
-		"Mallocs":       float64(mem.Mallocs),
-		"NextGC":        float64(mem.NextGC),
-		"NumForcedGC":   float64(mem.NumForcedGC),
-		"NumGC":         float64(mem.NumGC),
-		"OtherSys":      float64(mem.OtherSys),
-		"PauseTotalNs":  float64(mem.PauseTotalNs),
-		"StackInuse":    float64(mem.StackInuse),
-		"StackSys":      float64(mem.StackSys),
-		"Sys":           float64(mem.Sys),
-		"TotalAlloc":    float64(mem.TotalAlloc),
-	}
-
-	for name, value := range runtimeMetrics {
-		val := value
-		if err := a.sendJSON("gauge", name, nil, &val); err != nil {
-			return err
-		}
-	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.pending, metricKey(m))
+}
 
-	return nil
+func (a *Agent) setIdentityHeaders(h http.Header) {
+	h.Set("X-Agent-ID", a.id)
+	h.Set("X-Agent-Hostname", a.hostname)
+	h.Set("X-Agent-Start-Time", a.startTime.UTC().Format(time.RFC3339))
+	h.Set("X-Agent-Version", Version)
 }
 
-func (a *Agent) sendJSON(mtype, name string, delta *int64, value *float64) error {
-	url := fmt.Sprintf("http://%s/update/", a.cfg.Address)
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
 
-	metrics := models.Metrics{
-		ID:    name,
-		MType: mtype,
-		Delta: delta,
-		Value: value,
-	}
+func (a *Agent) sendJSON(metrics models.Metrics) error {
+	url := fmt.Sprintf("http://%s/update/", a.config().Address)
+	requestID := newRequestID()
+	name := metrics.ID + " (request " + requestID + ")"
 
+	// A metric that cannot be encoded, such as a NaN gauge, will never be
+	// accepted, so it is dropped like one the server rejects.
 	data, err := json.Marshal(metrics)
 	if err != nil {
-		return fmt.Errorf("marshal metric %s: %w", name, err)
+		return fmt.Errorf("marshal metric %s: %w: %w", name, err, errRejected)
 	}
 
 	var buf bytes.Buffer
@@ -160,6 +604,8 @@ func (a *Agent) sendJSON(mtype, name string, delta *int64, value *float64) error
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Content-Encoding", "gzip")
 	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("X-Request-ID", requestID)
+	a.setIdentityHeaders(req.Header)
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
@@ -167,6 +613,9 @@ func (a *Agent) sendJSON(mtype, name string, delta *int64, value *float64) error
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+		return fmt.Errorf("response for %s: %d: %w", name, resp.StatusCode, errRejected)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("response for %s: %d", name, resp.StatusCode)
 	}
@@ -187,8 +636,9 @@ func (a *Agent) sendJSON(mtype, name string, delta *int64, value *float64) error
 	}
 
 	a.logger.Debug().
-		Str("metric", name).
-		Str("type", mtype).
+		Str("metric", metrics.ID).
+		Str("type", metrics.MType).
+		Str("request_id", requestID).
 		Msg("metric sent successfully")
 
 	return nil
@@ -0,0 +1,316 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/collector"
+	"github.com/alex19451/httpserver/internal/config"
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAgent(t *testing.T, address string) *Agent {
+	t.Helper()
+	a, err := New(&config.AgentConfig{Address: address, RuntimeProfile: "memstats"}, zerolog.Nop())
+	assert.NoError(t, err)
+	return a
+}
+
+func gaugeMetric(id string, v float64) models.Metrics {
+	return models.Metrics{ID: id, MType: "gauge", Value: &v}
+}
+
+func counterMetric(id string, d int64) models.Metrics {
+	return models.Metrics{ID: id, MType: "counter", Delta: &d}
+}
+
+// fakeServer accepts every metric except those named "bad", which it
+// rejects with 400 like the real server does for invalid input.
+func fakeServer(t *testing.T) (*httptest.Server, func() []models.Metrics) {
+	var mu sync.Mutex
+	var accepted []models.Metrics
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		var m models.Metrics
+		assert.NoError(t, json.NewDecoder(gz).Decode(&m))
+
+		if m.ID == "bad" {
+			http.Error(w, "invalid metric", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		accepted = append(accepted, m)
+		mu.Unlock()
+		json.NewEncoder(w).Encode(m)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []models.Metrics {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]models.Metrics(nil), accepted...)
+	}
+}
+
+func ids(metrics []models.Metrics) []string {
+	result := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		result = append(result, m.ID)
+	}
+	return result
+}
+
+func TestReportSkipsRejectedMetrics(t *testing.T) {
+	srv, accepted := fakeServer(t)
+	a := newTestAgent(t, strings.TrimPrefix(srv.URL, "http://"))
+
+	a.record([]models.Metrics{
+		gaugeMetric("alpha", 1),
+		gaugeMetric("bad", 2),
+		gaugeMetric("zeta", 3),
+		counterMetric("hits", 4),
+	})
+	a.report()
+
+	assert.Equal(t, []string{"hits", "alpha", "zeta"}, ids(accepted()))
+
+	a.mu.Lock()
+	_, stuck := a.pending["gauge:bad"]
+	_, counterLeft := a.pending["counter:hits"]
+	a.mu.Unlock()
+	assert.False(t, stuck)
+	assert.False(t, counterLeft)
+}
+
+func TestReportDropsUnencodableMetrics(t *testing.T) {
+	srv, accepted := fakeServer(t)
+	a := newTestAgent(t, strings.TrimPrefix(srv.URL, "http://"))
+
+	a.record([]models.Metrics{
+		gaugeMetric("a", math.NaN()),
+		gaugeMetric("b", 1),
+	})
+	a.report()
+
+	assert.Equal(t, []string{"b"}, ids(accepted()))
+
+	a.mu.Lock()
+	_, stuck := a.pending["gauge:a"]
+	a.mu.Unlock()
+	assert.False(t, stuck)
+}
+
+func TestReportResendsCumulativePollCount(t *testing.T) {
+	srv, accepted := fakeServer(t)
+	a := newTestAgent(t, strings.TrimPrefix(srv.URL, "http://"))
+	a.collectors = nil
+
+	a.report()
+	assert.Empty(t, accepted())
+
+	for range 3 {
+		a.poll(context.Background())
+	}
+	a.report()
+	for range 2 {
+		a.poll(context.Background())
+	}
+	a.report()
+
+	sent := accepted()
+	assert.Equal(t, []string{"PollCount", "PollCount"}, ids(sent))
+	assert.Equal(t, int64(3), *sent[0].Delta)
+	assert.Equal(t, int64(5), *sent[1].Delta)
+}
+
+func TestGatewayValidatesMetrics(t *testing.T) {
+	a := newTestAgent(t, "localhost:0")
+
+	push := func(body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/update/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		a.gatewayUpdate(rec, req)
+		return rec
+	}
+
+	for _, body := range []string{
+		`{`,
+		`{"type":"gauge","value":1}`,
+		`{"id":"load","type":"gauge"}`,
+		`{"id":"hits","type":"counter","value":1}`,
+		`{"id":"load","type":"summary","value":1}`,
+		`{"id":"load{x}","type":"gauge","value":1}`,
+		`{"id":"load","type":"gauge","value":1,"labels":{"bad-name":"x"}}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, push(body).Code, body)
+	}
+	assert.Equal(t, http.StatusBadRequest, push(`{"id":"load","type":"gauge","value":1}`, "Content-Type", "text/plain").Code)
+	assert.Equal(t, http.StatusBadRequest, push(`not gzip`, "Content-Encoding", "gzip").Code)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"id":"hits","type":"counter","delta":2,"labels":{"job":"cron"}}`))
+	gz.Close()
+	rec := push(buf.String(), "Content-Encoding", "gzip")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"id":"hits","type":"counter","delta":2,"labels":{"job":"cron"}}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusOK, push(`{"id":"hits","type":"counter","delta":3,"labels":{"job":"cron"}}`).Code)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	assert.Len(t, a.pending, 1)
+	assert.Equal(t, int64(5), *a.pending[`counter:hits{job="cron"}`].Delta)
+}
+
+func TestWindowAggregation(t *testing.T) {
+	srv, accepted := fakeServer(t)
+	a, err := New(&config.AgentConfig{
+		Address:        strings.TrimPrefix(srv.URL, "http://"),
+		RuntimeProfile: "memstats",
+		AggregateRules: "load*=min,max,mean,p95,last; temp=last",
+	}, zerolog.Nop())
+	assert.NoError(t, err)
+
+	for i := 20; i >= 1; i-- {
+		m := gaugeMetric("load", float64(i))
+		m.Labels = map[string]string{"core": "0"}
+		a.record([]models.Metrics{m, gaugeMetric("temp", float64(i))})
+	}
+	a.report()
+
+	values := func(metrics []models.Metrics) map[string]float64 {
+		result := make(map[string]float64)
+		for _, m := range metrics {
+			if m.Value != nil {
+				result[m.ID] = *m.Value
+			}
+		}
+		return result
+	}
+
+	sent := accepted()
+	assert.Equal(t, map[string]float64{
+		"load":      1,
+		"load_max":  20,
+		"load_mean": 10.5,
+		"load_min":  1,
+		"load_p95":  19,
+		"temp":      1,
+	}, values(sent))
+	for _, m := range sent {
+		if strings.HasPrefix(m.ID, "load") {
+			assert.Equal(t, map[string]string{"core": "0"}, m.Labels, m.ID)
+		}
+	}
+
+	// Each report starts a new window.
+	m := gaugeMetric("load", 7)
+	m.Labels = map[string]string{"core": "0"}
+	a.record([]models.Metrics{m})
+	a.report()
+	last := values(accepted()[len(sent):])
+	assert.Equal(t, 7.0, last["load_min"])
+	assert.Equal(t, 7.0, last["load_max"])
+	assert.Equal(t, 7.0, last["load_p95"])
+
+	for _, spec := range []string{"load", "=min", "[=min", "load=median"} {
+		_, err := parseAggregateRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestReloadKeepsPendingAndRestartOnlySettings(t *testing.T) {
+	cfg := &config.AgentConfig{
+		Address:        "localhost:8080",
+		AgentID:        "a1",
+		RuntimeProfile: "memstats",
+		PollInterval:   config.Duration(2 * time.Second),
+		ReportInterval: config.Duration(10 * time.Second),
+	}
+	a, err := New(cfg, zerolog.Nop())
+	assert.NoError(t, err)
+	a.record([]models.Metrics{counterMetric("hits", 3)})
+	collectors := a.collectors
+
+	next := *cfg
+	next.AgentID = "a2"
+	next.PollInterval = config.Duration(time.Second)
+	next.AggregateRules = "load=max"
+	assert.NoError(t, a.Reload(&next))
+
+	assert.Equal(t, "a1", a.config().AgentID)
+	assert.Equal(t, config.Duration(time.Second), a.config().PollInterval)
+	assert.Len(t, a.reloaded, 1)
+	assert.Equal(t, []string{"max"}, a.aggregateFuncsFor("load"))
+	assert.Equal(t, collectors, a.collectors)
+	assert.Equal(t, int64(3), *a.pending["counter:hits"].Delta)
+
+	next.RuntimeProfile = "metrics"
+	assert.NoError(t, a.Reload(&next))
+	assert.IsType(t, &collector.RuntimeMetrics{}, a.collectors[0])
+
+	// Only the collectors whose settings changed are rebuilt, so the others
+	// keep their counter baselines.
+	next.PromURLs = "http://localhost:9100/metrics"
+	next.ExecCommands = "disk=true"
+	assert.NoError(t, a.Reload(&next))
+	collectors = a.collectors
+
+	next.ExecTimeout = config.Duration(time.Minute)
+	assert.NoError(t, a.Reload(&next))
+	assert.Same(t, collectors[0], a.collectors[0])
+	assert.Same(t, collectors[1], a.collectors[1])
+	assert.NotSame(t, collectors[2], a.collectors[2])
+
+	next.PromURLs = ""
+	assert.NoError(t, a.Reload(&next))
+	assert.Nil(t, a.collectors[1])
+
+	bad := next
+	bad.AggregateRules = "load=median"
+	assert.Error(t, a.Reload(&bad))
+	assert.Equal(t, "load=max", a.config().AggregateRules)
+}
+
+func TestValidateConfigSpecs(t *testing.T) {
+	cfg := &config.AgentConfig{
+		Address:          "localhost:8080",
+		RuntimeProfile:   "memstats",
+		AggregateRules:   "load=median",
+		PromRename:       "[=x",
+		ExecCommands:     "=true",
+		LogRules:         "/var/log/app.log|(|errors|counter",
+		ProcessSelectors: "=",
+	}
+	err := ValidateConfig(cfg)
+	for _, name := range []string{"aggregate_rules", "prom_rename", "exec_commands", "logtail_rules", "process_selectors"} {
+		assert.ErrorContains(t, err, name)
+	}
+
+	_, err = New(cfg, zerolog.Nop())
+	assert.Error(t, err)
+
+	a := newTestAgent(t, "localhost:8080")
+	bad := *a.config()
+	bad.LogRules = cfg.LogRules
+	assert.ErrorContains(t, a.Reload(&bad), "logtail_rules")
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+var aggregateFuncs = map[string]func(sorted []float64) float64{
+	"last": nil,
+	"min": func(s []float64) float64 {
+		return s[0]
+	},
+	"max": func(s []float64) float64 {
+		return s[len(s)-1]
+	},
+	"mean": func(s []float64) float64 {
+		var sum float64
+		for _, v := range s {
+			sum += v
+		}
+		return sum / float64(len(s))
+	},
+	"p95": func(s []float64) float64 {
+		return s[int(math.Ceil(0.95*float64(len(s))))-1]
+	},
+}
+
+type aggregateRule struct {
+	pattern string
+	funcs   []string
+}
+
+// parseAggregateRules parses "glob=fn,fn;glob=fn". "last" is the plain
+// metric, which is always reported; the other functions add gauges with a
+// _fn suffix.
+func parseAggregateRules(spec string) ([]aggregateRule, error) {
+	var rules []aggregateRule
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, list, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("aggregate rule %q: expected glob=fn,fn", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("aggregate rule %q: %w", item, err)
+		}
+
+		rule := aggregateRule{pattern: pattern}
+		for _, fn := range splitList(list) {
+			if _, ok := aggregateFuncs[fn]; !ok {
+				return nil, fmt.Errorf("aggregate rule %q: unknown function %q", item, fn)
+			}
+			if fn != "last" {
+				rule.funcs = append(rule.funcs, fn)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (a *Agent) aggregateFuncsFor(name string) []string {
+	for _, r := range a.aggregates {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r.funcs
+		}
+	}
+	return nil
+}
+
+// observe adds a gauge sample to the poll window of its series.
+func (a *Agent) observe(key string, m models.Metrics) {
+	if m.Value == nil || len(a.aggregateFuncsFor(m.ID)) == 0 {
+		return
+	}
+	a.window[key] = append(a.window[key], windowSample{metric: m, value: *m.Value})
+}
+
+type windowSample struct {
+	metric models.Metrics
+	value  float64
+}
+
+// flushWindow turns the samples gathered since the last report into suffixed
+// gauges and starts a new window. The caller holds a.mu.
+func (a *Agent) flushWindow() {
+	for key, samples := range a.window {
+		values := make([]float64, len(samples))
+		for i, s := range samples {
+			values[i] = s.value
+		}
+		sort.Float64s(values)
+
+		last := samples[len(samples)-1].metric
+		for _, fn := range a.aggregateFuncsFor(last.ID) {
+			v := aggregateFuncs[fn](values)
+			m := last
+			m.ID = last.ID + "_" + fn
+			m.Value = &v
+			k := metricKey(m)
+			a.pending[k] = m
+			a.totals[k] = m
+		}
+		delete(a.window, key)
+	}
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/collector"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+func gatewayListener(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+func (a *Agent) serveGateway() {
+	ln, err := gatewayListener(a.config().GatewayAddress)
+	if err != nil {
+		a.logger.Error().Err(err).Str("gateway_address", a.config().GatewayAddress).Msg("failed to start push gateway")
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /update/", a.gatewayUpdate)
+
+	a.logger.Info().Str("gateway_address", a.config().GatewayAddress).Msg("push gateway starting")
+
+	if err := http.Serve(ln, mux); err != nil {
+		a.logger.Error().Err(err).Msg("push gateway failed")
+	}
+}
+
+func (a *Agent) gatewayUpdate(w http.ResponseWriter, r *http.Request) {
+	body := r.Body
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var metrics models.Metrics
+	if err := json.NewDecoder(body).Decode(&metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := collector.ValidateMetric(metrics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.record([]models.Metrics{metrics})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics)
+}
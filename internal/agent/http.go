@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (a *Agent) serve() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", a.metricsHandler)
+
+	a.logger.Info().Str("listen_address", a.config().ListenAddress).Msg("agent metrics endpoint starting")
+
+	if err := http.ListenAndServe(a.config().ListenAddress, mux); err != nil {
+		a.logger.Error().Err(err).Msg("agent metrics endpoint failed")
+	}
+}
+
+func (a *Agent) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.setIdentityHeaders(w.Header())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.snapshot())
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]models.Metrics, error)
+}
+
+// ValidateMetric checks that m is a well-formed gauge or counter the server
+// will accept.
+func ValidateMetric(m models.Metrics) error {
+	if m.ID == "" || m.MType == "" {
+		return errors.New("id and type are required")
+	}
+	if err := labels.ValidateName(m.ID); err != nil {
+		return err
+	}
+	if err := labels.Validate(m.Labels); err != nil {
+		return err
+	}
+
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			return errors.New("value is required for gauge")
+		}
+		if math.IsNaN(*m.Value) || math.IsInf(*m.Value, 0) {
+			return errors.New("gauge value must be finite")
+		}
+	case "counter":
+		if m.Delta == nil {
+			return errors.New("delta is required for counter")
+		}
+	default:
+		return errors.New("invalid metric type")
+	}
+	return nil
+}
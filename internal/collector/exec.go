@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type ExecCommand struct {
+	Name    string
+	Command string
+}
+
+func ParseExecCommands(spec string) ([]ExecCommand, error) {
+	var commands []ExecCommand
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, command, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(name) == "" || strings.TrimSpace(command) == "" {
+			return nil, fmt.Errorf("exec command %q: expected name=command", item)
+		}
+		commands = append(commands, ExecCommand{Name: strings.TrimSpace(name), Command: strings.TrimSpace(command)})
+	}
+	return commands, nil
+}
+
+type Exec struct {
+	commands []ExecCommand
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	running map[string]bool
+	results []models.Metrics
+	errs    []error
+}
+
+func NewExec(commands []ExecCommand, timeout time.Duration) *Exec {
+	return &Exec{
+		commands: commands,
+		timeout:  timeout,
+		running:  make(map[string]bool),
+	}
+}
+
+func (c *Exec) Name() string {
+	return "exec"
+}
+
+func (c *Exec) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results, errs := c.results, c.errs
+	c.results, c.errs = nil, nil
+
+	for _, cmd := range c.commands {
+		if c.running[cmd.Name] {
+			continue
+		}
+		c.running[cmd.Name] = true
+		go c.run(cmd)
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func (c *Exec) run(cmd ExecCommand) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	proc := exec.CommandContext(ctx, "sh", "-c", cmd.Command)
+	proc.Stdout = &stdout
+	proc.WaitDelay = time.Second
+
+	start := time.Now()
+	runErr := proc.Run()
+	duration := time.Since(start).Seconds()
+
+	ls := map[string]string{"check": cmd.Name}
+	exitCode := 0.0
+	var errs []error
+
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		exitCode = -1
+		errs = append(errs, fmt.Errorf("check %s timed out after %s", cmd.Name, c.timeout))
+	case runErr != nil:
+		var exitErr *exec.ExitError
+		if errors.As(runErr, &exitErr) {
+			exitCode = float64(exitErr.ExitCode())
+		} else {
+			exitCode = -1
+			errs = append(errs, fmt.Errorf("check %s: %w", cmd.Name, runErr))
+		}
+	}
+
+	metrics := []models.Metrics{
+		models.Gauge("exec_exit_code", exitCode, ls),
+		models.Gauge("exec_duration_seconds", duration, ls),
+	}
+
+	if exitCode >= 0 {
+		parsed, err := parseExecOutput(stdout.Bytes(), ls)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("check %s: %w", cmd.Name, err))
+		}
+		metrics = append(metrics, parsed...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running[cmd.Name] = false
+	c.results = append(c.results, metrics...)
+	c.errs = append(c.errs, errs...)
+}
+
+func withLabels(m models.Metrics, extra map[string]string) models.Metrics {
+	ls := make(map[string]string, len(m.Labels)+len(extra))
+	for k, v := range extra {
+		ls[k] = v
+	}
+	for k, v := range m.Labels {
+		ls[k] = v
+	}
+	m.Labels = ls
+	return m
+}
+
+func parseExecOutput(out []byte, ls map[string]string) ([]models.Metrics, error) {
+	trimmed := bytes.TrimSpace(out)
+	if len(trimmed) == 0 {
+		return nil, nil
+	}
+
+	if trimmed[0] == '{' || trimmed[0] == '[' {
+		var metrics []models.Metrics
+		if trimmed[0] == '{' {
+			var m models.Metrics
+			if err := json.Unmarshal(trimmed, &m); err != nil {
+				return nil, fmt.Errorf("decode JSON output: %w", err)
+			}
+			metrics = append(metrics, m)
+		} else if err := json.Unmarshal(trimmed, &metrics); err != nil {
+			return nil, fmt.Errorf("decode JSON output: %w", err)
+		}
+
+		result := make([]models.Metrics, 0, len(metrics))
+		var errs []error
+		for _, m := range metrics {
+			if err := ValidateMetric(m); err != nil {
+				errs = append(errs, fmt.Errorf("invalid metric %q in JSON output: %w", m.ID, err))
+				continue
+			}
+			result = append(result, withLabels(m, ls))
+		}
+		return result, errors.Join(errs...)
+	}
+
+	var result []models.Metrics
+	scanner := bufio.NewScanner(bytes.NewReader(trimmed))
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return result, fmt.Errorf("line %d: expected \"type name value\"", lineNo)
+		}
+		if err := labels.ValidateName(fields[1]); err != nil {
+			return result, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+
+		switch fields[0] {
+		case "gauge":
+			v, err := strconv.ParseFloat(fields[2], 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return result, fmt.Errorf("line %d: invalid gauge value %q", lineNo, fields[2])
+			}
+			result = append(result, models.Gauge(fields[1], v, ls))
+		case "counter":
+			v, err := strconv.ParseInt(fields[2], 10, 64)
+			if err != nil {
+				return result, fmt.Errorf("line %d: invalid counter value %q", lineNo, fields[2])
+			}
+			result = append(result, models.Counter(fields[1], v, ls))
+		default:
+			return result, fmt.Errorf("line %d: unknown type %q", lineNo, fields[0])
+		}
+	}
+
+	return result, nil
+}
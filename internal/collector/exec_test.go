@@ -0,0 +1,45 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExecOutputRejectsNonFinite(t *testing.T) {
+	for _, value := range []string{"NaN", "Inf", "-inf", "+Inf"} {
+		metrics, err := parseExecOutput([]byte("gauge ok 1\ngauge bad "+value+"\n"), nil)
+		assert.ErrorContains(t, err, "line 2: invalid gauge value", value)
+		assert.Len(t, metrics, 1, value)
+	}
+
+	for _, v := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		assert.Error(t, ValidateMetric(models.Gauge("load", v, nil)), v)
+	}
+	assert.NoError(t, ValidateMetric(models.Gauge("load", 1, nil)))
+}
+
+func TestExecRejectsInvalidJSONMetrics(t *testing.T) {
+	cmds, err := ParseExecCommands(`disk=echo '[{"id":"ok","type":"gauge","value":1},{"id":"x","type":"histogram","value":1},{"id":"y","type":"gauge","value":2,"labels":{"bad-name":"v"}}]'`)
+	assert.NoError(t, err)
+	c := NewExec(cmds, time.Second)
+
+	c.Collect(context.Background())
+	var metrics []models.Metrics
+	assert.Eventually(t, func() bool {
+		ms, err := c.Collect(context.Background())
+		for _, m := range ms {
+			if m.MType == "gauge" && m.ID == "ok" {
+				metrics = append(metrics, m)
+			}
+		}
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "disk", metrics[0].Labels["check"])
+}
@@ -0,0 +1,349 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+const (
+	fingerprintSize = 64
+	maxReadPerPoll  = 4 << 20
+)
+
+type LogRule struct {
+	Path       string
+	Pattern    *regexp.Regexp
+	Metric     string
+	Type       string
+	ValueGroup string
+}
+
+func ParseLogRules(spec string) ([]LogRule, error) {
+	var rules []LogRule
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "|")
+		if len(parts) < 4 || len(parts) > 5 {
+			return nil, fmt.Errorf("log rule %q: expected path|regex|metric|type[|value_group]", item)
+		}
+
+		re, err := regexp.Compile(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("log rule %q: %w", item, err)
+		}
+
+		r := LogRule{Path: parts[0], Pattern: re, Metric: parts[2], Type: parts[3]}
+		if r.Metric == "" {
+			return nil, fmt.Errorf("log rule %q: metric name is required", item)
+		}
+		if err := labels.ValidateName(r.Metric); err != nil {
+			return nil, fmt.Errorf("log rule %q: %w", item, err)
+		}
+		if len(parts) == 5 {
+			r.ValueGroup = parts[4]
+			if re.SubexpIndex(r.ValueGroup) < 0 {
+				return nil, fmt.Errorf("log rule %q: no capture group named %q", item, r.ValueGroup)
+			}
+		}
+		if r.Type != "gauge" && r.Type != "counter" {
+			return nil, fmt.Errorf("log rule %q: unknown type %q", item, r.Type)
+		}
+		if r.Type == "gauge" && r.ValueGroup == "" {
+			return nil, fmt.Errorf("log rule %q: gauge rules require a value group", item)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+type fileState struct {
+	Offset      int64  `json:"offset"`
+	Fingerprint []byte `json:"fingerprint"`
+}
+
+// LogTail keeps each watched file open between polls, so lines written to
+// a file after it has been rotated away are still read before switching to
+// its replacement.
+type LogTail struct {
+	rules     map[string][]LogRule
+	statePath string
+
+	mu     sync.Mutex
+	state  map[string]fileState
+	files  map[string]*os.File
+	closed bool
+}
+
+func NewLogTail(rules []LogRule, statePath string) (*LogTail, error) {
+	c := &LogTail{
+		rules:     make(map[string][]LogRule),
+		statePath: statePath,
+		state:     make(map[string]fileState),
+		files:     make(map[string]*os.File),
+	}
+	for _, r := range rules {
+		c.rules[r.Path] = append(c.rules[r.Path], r)
+	}
+
+	if statePath != "" {
+		data, err := os.ReadFile(statePath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("read log tail state: %w", err)
+		}
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &c.state); err != nil {
+				return nil, fmt.Errorf("decode log tail state: %w", err)
+			}
+		}
+	}
+
+	return c, nil
+}
+
+func (c *LogTail) Name() string {
+	return "logtail"
+}
+
+func (c *LogTail) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, nil
+	}
+
+	var metrics []models.Metrics
+	var errs []error
+
+	for path, rules := range c.rules {
+		lines, err := c.readNew(path)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		for _, line := range lines {
+			metrics = append(metrics, matchLine(rules, line)...)
+		}
+	}
+
+	if err := c.saveState(); err != nil {
+		errs = append(errs, err)
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+// Close releases the files kept open between polls.
+func (c *LogTail) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	var errs []error
+	for path, f := range c.files {
+		errs = append(errs, f.Close())
+		delete(c.files, path)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *LogTail) readNew(path string) ([]string, error) {
+	st, known := c.state[path]
+	cur := c.files[path]
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("stat %s: %w", path, err)
+		}
+		if !known {
+			// Whatever is written once the file appears is new.
+			c.state[path] = fileState{}
+		}
+		if cur == nil {
+			return nil, nil
+		}
+		// The file was moved away and not replaced yet; keep reading the
+		// old one, which may still be written to.
+		lines, offset, err := readLines(cur, st.Offset, false)
+		st.Offset = offset
+		c.state[path] = st
+		if err != nil {
+			return lines, fmt.Errorf("read %s: %w", path, err)
+		}
+		return lines, nil
+	}
+
+	var drained []string
+	if cur != nil {
+		curInfo, err := cur.Stat()
+		if err == nil && os.SameFile(curInfo, info) {
+			return c.readFile(path, cur, st, info)
+		}
+		// Rotated: finish the old file, including a last unterminated line,
+		// before switching to the new one at its start.
+		drained, _, err = readLines(cur, st.Offset, true)
+		cur.Close()
+		delete(c.files, path)
+		st, known = fileState{}, true
+		if err != nil {
+			return drained, fmt.Errorf("read %s: %w", path, err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return drained, nil
+		}
+		return drained, fmt.Errorf("open %s: %w", path, err)
+	}
+	if info, err = f.Stat(); err != nil {
+		f.Close()
+		return drained, fmt.Errorf("stat %s: %w", path, err)
+	}
+	c.files[path] = f
+
+	if !known {
+		// Files present when the agent first starts are tailed from their
+		// current end rather than replayed.
+		head, err := readHead(f, info.Size())
+		if err != nil {
+			return drained, fmt.Errorf("read %s: %w", path, err)
+		}
+		c.state[path] = fileState{Offset: info.Size(), Fingerprint: head}
+		return drained, nil
+	}
+
+	lines, err := c.readFile(path, f, st, info)
+	return append(drained, lines...), err
+}
+
+// readFile reads the complete lines appended to f since st, starting over
+// when the file no longer matches the recorded fingerprint or has shrunk.
+func (c *LogTail) readFile(path string, f *os.File, st fileState, info os.FileInfo) ([]string, error) {
+	head, err := readHead(f, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if !bytes.HasPrefix(head, st.Fingerprint) || info.Size() < st.Offset {
+		st = fileState{}
+	}
+	st.Fingerprint = head
+
+	lines, offset, err := readLines(f, st.Offset, false)
+	st.Offset = offset
+	c.state[path] = st
+	if err != nil {
+		return lines, fmt.Errorf("read %s: %w", path, err)
+	}
+	return lines, nil
+}
+
+func readHead(f *os.File, size int64) ([]byte, error) {
+	head := make([]byte, min(fingerprintSize, size))
+	if _, err := f.ReadAt(head, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return head, nil
+}
+
+// readLines reads the lines after offset and returns the offset following
+// the last one. A trailing line without a newline is left for the next
+// poll unless final is set.
+func readLines(f *os.File, offset int64, final bool) ([]string, int64, error) {
+	reader := bufio.NewReader(io.NewSectionReader(f, offset, maxReadPerPoll))
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err == nil || (final && line != "") {
+			offset += int64(len(line))
+			lines = append(lines, strings.TrimRight(line, "\r\n"))
+		}
+		if err == io.EOF {
+			return lines, offset, nil
+		}
+		if err != nil {
+			return lines, offset, err
+		}
+	}
+}
+
+func (c *LogTail) saveState() error {
+	if c.statePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.statePath), 0755); err != nil {
+		return err
+	}
+
+	tmp := c.statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write log tail state: %w", err)
+	}
+	return os.Rename(tmp, c.statePath)
+}
+
+func matchLine(rules []LogRule, line string) []models.Metrics {
+	var metrics []models.Metrics
+	for _, r := range rules {
+		match := r.Pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		var ls map[string]string
+		for i, name := range r.Pattern.SubexpNames() {
+			if name == "" || name == r.ValueGroup || i >= len(match) {
+				continue
+			}
+			if ls == nil {
+				ls = make(map[string]string)
+			}
+			ls[name] = match[i]
+		}
+
+		if r.Type == "counter" {
+			delta := int64(1)
+			if r.ValueGroup != "" {
+				v, err := strconv.ParseInt(match[r.Pattern.SubexpIndex(r.ValueGroup)], 10, 64)
+				if err != nil {
+					continue
+				}
+				delta = v
+			}
+			metrics = append(metrics, models.Counter(r.Metric, delta, ls))
+			continue
+		}
+
+		v, err := strconv.ParseFloat(match[r.Pattern.SubexpIndex(r.ValueGroup)], 64)
+		if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		metrics = append(metrics, models.Gauge(r.Metric, v, ls))
+	}
+	return metrics
+}
@@ -0,0 +1,148 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func appendFile(t *testing.T, path, data string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(data)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+}
+
+func kinds(metrics []models.Metrics) []string {
+	var result []string
+	for _, m := range metrics {
+		result = append(result, m.Labels["kind"])
+	}
+	return result
+}
+
+func TestLogTailDrainsRotatedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "ERROR before start\n")
+
+	rules, err := ParseLogRules(path + `|ERROR (?P<kind>\w+)|errors|counter`)
+	assert.NoError(t, err)
+	c, err := NewLogTail(rules, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	appendFile(t, path, "ERROR disk\n")
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"disk"}, kinds(metrics))
+
+	// Lines written just before rotation are read from the old file, then
+	// the new file is read from its start.
+	appendFile(t, path, "ERROR late\nERROR partial")
+	assert.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "ERROR net\n")
+
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"late", "partial", "net"}, kinds(metrics))
+}
+
+func TestLogTailReadsFileCreatedAfterStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	rules, err := ParseLogRules(path + `|ERROR (?P<kind>\w+)|errors|counter`)
+	assert.NoError(t, err)
+	c, err := NewLogTail(rules, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	appendFile(t, path, "ERROR first\n")
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first"}, kinds(metrics))
+}
+
+func TestLogTailSkipsNonFiniteValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, path, "")
+
+	rules, err := ParseLogRules(path + `|load (?P<value>\S+)|load|gauge|value`)
+	assert.NoError(t, err)
+	c, err := NewLogTail(rules, "")
+	assert.NoError(t, err)
+	defer c.Close()
+
+	_, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	appendFile(t, path, "load NaN\nload Inf\nload 2.5\n")
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, 2.5, *metrics[0].Value)
+	}
+}
+
+func TestParseLogRulesErrors(t *testing.T) {
+	for _, spec := range []string{
+		"app.log|x|errors",
+		"app.log|(|errors|counter",
+		"app.log|x|bad{name}|counter",
+		"app.log|x||counter",
+		"app.log|x|errors|histogram",
+		"app.log|x|load|gauge",
+		"app.log|x|load|gauge|value",
+	} {
+		_, err := ParseLogRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestLogTailRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	assert.NoError(t, os.WriteFile(path, []byte("ERROR before start\n"), 0644))
+
+	rules, err := ParseLogRules(path + `|ERROR (?P<kind>\w+)|errors|counter`)
+	assert.NoError(t, err)
+	c, err := NewLogTail(rules, filepath.Join(dir, "state.json"))
+	assert.NoError(t, err)
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, metrics)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString("ERROR disk\nINFO ok\nERROR par")
+	assert.NoError(t, err)
+	f.Close()
+
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, map[string]string{"kind": "disk"}, metrics[0].Labels)
+
+	assert.NoError(t, os.Rename(path, path+".1"))
+	assert.NoError(t, os.WriteFile(path, []byte("ERROR net\n"), 0644))
+
+	c, err = NewLogTail(rules, filepath.Join(dir, "state.json"))
+	assert.NoError(t, err)
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, metrics, 1)
+	assert.Equal(t, "net", metrics[0].Labels["kind"])
+}
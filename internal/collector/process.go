@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+// clockTicks is USER_HZ, which is 100 on every mainstream Linux platform.
+const clockTicks = 100
+
+type ProcessSelector struct {
+	Name    string
+	Comm    string
+	PIDFile string
+	Cmdline *regexp.Regexp
+}
+
+// ParseProcessSelectors parses "name=kind:value;..." where kind is one of
+// name, pidfile or cmdline.
+func ParseProcessSelectors(spec string) ([]ProcessSelector, error) {
+	var selectors []ProcessSelector
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, sel, ok := strings.Cut(item, "=")
+		kind, value, ok2 := strings.Cut(sel, ":")
+		if !ok || !ok2 || name == "" || value == "" {
+			return nil, fmt.Errorf("process selector %q: expected name=kind:value", item)
+		}
+
+		s := ProcessSelector{Name: name}
+		switch kind {
+		case "name":
+			s.Comm = value
+		case "pidfile":
+			s.PIDFile = value
+		case "cmdline":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("process selector %q: %w", item, err)
+			}
+			s.Cmdline = re
+		default:
+			return nil, fmt.Errorf("process selector %q: unknown kind %q", item, kind)
+		}
+		selectors = append(selectors, s)
+	}
+	return selectors, nil
+}
+
+type procStat struct {
+	rss        int64
+	threads    int64
+	fds        int64
+	cpuMillis  int64
+	readBytes  int64
+	writeBytes int64
+}
+
+type Process struct {
+	selectors []ProcessSelector
+	root      string
+
+	mu     sync.Mutex
+	primed bool
+	prev   map[string]procStat
+}
+
+func NewProcess(selectors []ProcessSelector) *Process {
+	return &Process{
+		selectors: selectors,
+		root:      "/proc",
+		prev:      make(map[string]procStat),
+	}
+}
+
+func (c *Process) Name() string {
+	return "process"
+}
+
+func (c *Process) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entries, err := os.ReadDir(c.root)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", c.root, err)
+	}
+	var pids []string
+	for _, e := range entries {
+		if _, err := strconv.Atoi(e.Name()); err == nil {
+			pids = append(pids, e.Name())
+		}
+	}
+
+	var metrics []models.Metrics
+	var errs []error
+	seen := make(map[string]procStat)
+
+	for _, sel := range c.selectors {
+		matched, err := c.match(sel, pids)
+		if err != nil {
+			errs = append(errs, err)
+		}
+
+		var total, delta procStat
+		count := 0
+		for _, pid := range matched {
+			id, st, err := c.read(pid)
+			if err != nil {
+				continue
+			}
+			count++
+			total.rss += st.rss
+			total.threads += st.threads
+			total.fds += st.fds
+
+			// A process keyed by pid and start time either continues from its
+			// previous sample or is new since the last poll and counts in full.
+			prev, ok := c.prev[id]
+			if !ok && !c.primed {
+				prev = st
+			}
+			delta.cpuMillis += st.cpuMillis - prev.cpuMillis
+			delta.readBytes += st.readBytes - prev.readBytes
+			delta.writeBytes += st.writeBytes - prev.writeBytes
+			seen[id] = st
+		}
+
+		ls := map[string]string{"process": sel.Name}
+		metrics = append(metrics,
+			models.Gauge("process_count", float64(count), ls),
+			models.Gauge("process_rss_bytes", float64(total.rss), ls),
+			models.Gauge("process_threads", float64(total.threads), ls),
+			models.Gauge("process_open_fds", float64(total.fds), ls),
+			models.Counter("process_cpu_milliseconds", delta.cpuMillis, ls),
+			models.Counter("process_read_bytes", delta.readBytes, ls),
+			models.Counter("process_write_bytes", delta.writeBytes, ls),
+		)
+	}
+
+	c.prev = seen
+	c.primed = true
+	return metrics, errors.Join(errs...)
+}
+
+func (c *Process) match(sel ProcessSelector, pids []string) ([]string, error) {
+	if sel.PIDFile != "" {
+		data, err := os.ReadFile(sel.PIDFile)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("process %s: %w", sel.Name, err)
+		}
+		pid := strings.TrimSpace(string(data))
+		if _, err := strconv.Atoi(pid); err != nil {
+			return nil, fmt.Errorf("process %s: invalid pid %q in %s", sel.Name, pid, sel.PIDFile)
+		}
+		return []string{pid}, nil
+	}
+
+	var matched []string
+	for _, pid := range pids {
+		if sel.Comm != "" {
+			comm, err := os.ReadFile(filepath.Join(c.root, pid, "comm"))
+			if err == nil && strings.TrimSpace(string(comm)) == sel.Comm {
+				matched = append(matched, pid)
+			}
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join(c.root, pid, "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		cmdline = bytes.TrimRight(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}), " ")
+		if sel.Cmdline.Match(cmdline) {
+			matched = append(matched, pid)
+		}
+	}
+	return matched, nil
+}
+
+// read returns the process identity (pid and start time, so reused pids are
+// not mistaken for the same process) and its current resource usage.
+func (c *Process) read(pid string) (string, procStat, error) {
+	dir := filepath.Join(c.root, pid)
+
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return "", procStat{}, err
+	}
+	end := bytes.LastIndexByte(data, ')')
+	if end < 0 {
+		return "", procStat{}, fmt.Errorf("malformed stat for pid %s", pid)
+	}
+	fields := strings.Fields(string(data[end+1:]))
+	if len(fields) < 22 {
+		return "", procStat{}, fmt.Errorf("malformed stat for pid %s", pid)
+	}
+
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	threads, _ := strconv.ParseInt(fields[17], 10, 64)
+	rssPages, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	st := procStat{
+		rss:       rssPages * int64(os.Getpagesize()),
+		threads:   threads,
+		cpuMillis: (utime + stime) * 1000 / clockTicks,
+	}
+
+	if fds, err := os.ReadDir(filepath.Join(dir, "fd")); err == nil {
+		st.fds = int64(len(fds))
+	}
+
+	if io, err := os.ReadFile(filepath.Join(dir, "io")); err == nil {
+		for _, line := range strings.Split(string(io), "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			n, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			switch key {
+			case "read_bytes":
+				st.readBytes = n
+			case "write_bytes":
+				st.writeBytes = n
+			}
+		}
+	}
+
+	return pid + "@" + fields[19], st, nil
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProc struct {
+	comm, cmdline         string
+	utime, stime, start   int64
+	threads, rssPages     int64
+	readBytes, writeBytes int64
+	fds                   int
+}
+
+func writeProc(t *testing.T, root, pid string, p fakeProc) {
+	t.Helper()
+	dir := filepath.Join(root, pid)
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, "fd")))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "fd"), 0755))
+	for i := 0; i < p.fds; i++ {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "fd", fmt.Sprint(i)), nil, 0644))
+	}
+
+	// Fields 3 to 24 of /proc/<pid>/stat; the comm may contain spaces and
+	// parentheses, so parsing starts after the last ')'.
+	fields := make([]string, 22)
+	for i := range fields {
+		fields[i] = "0"
+	}
+	fields[0] = "S"
+	fields[11] = fmt.Sprint(p.utime)
+	fields[12] = fmt.Sprint(p.stime)
+	fields[17] = fmt.Sprint(p.threads)
+	fields[19] = fmt.Sprint(p.start)
+	fields[21] = fmt.Sprint(p.rssPages)
+	stat := fmt.Sprintf("%s (%s) %s\n", pid, p.comm+" (x)", strings.Join(fields, " "))
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "comm"), []byte(p.comm+"\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cmdline"), []byte(strings.ReplaceAll(p.cmdline, " ", "\x00")+"\x00"), 0644))
+	io := fmt.Sprintf("rchar: 1\nread_bytes: %d\nwrite_bytes: %d\n", p.readBytes, p.writeBytes)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "io"), []byte(io), 0644))
+
+}
+
+func processValues(metrics []models.Metrics, process string) map[string]float64 {
+	result := make(map[string]float64)
+	for _, m := range metrics {
+		if m.Labels["process"] != process {
+			continue
+		}
+		if m.Value != nil {
+			result[m.ID] = *m.Value
+		} else {
+			result[m.ID] = float64(*m.Delta)
+		}
+	}
+	return result
+}
+
+func TestProcessCollector(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "self"), 0755))
+
+	worker := fakeProc{comm: "worker", cmdline: "/usr/bin/worker --queue=mail", utime: 100, stime: 50, start: 1000, threads: 4, rssPages: 10, readBytes: 4096, writeBytes: 100, fds: 3}
+	writeProc(t, root, "10", worker)
+	writeProc(t, root, "11", fakeProc{comm: "worker", cmdline: "/usr/bin/worker --queue=sms", start: 1001, threads: 2, rssPages: 5, fds: 1})
+	writeProc(t, root, "12", fakeProc{comm: "nginx", cmdline: "nginx: master process", start: 900, threads: 1})
+
+	pidFile := filepath.Join(t.TempDir(), "nginx.pid")
+	assert.NoError(t, os.WriteFile(pidFile, []byte("12\n"), 0644))
+
+	selectors, err := ParseProcessSelectors("workers=name:worker; mail=cmdline:queue=mail; web=pidfile:" + pidFile + "; gone=pidfile:/nonexistent/pid")
+	assert.NoError(t, err)
+
+	c := NewProcess(selectors)
+	c.root = root
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+
+	page := float64(os.Getpagesize())
+	assert.Equal(t, map[string]float64{
+		"process_count":            2,
+		"process_rss_bytes":        15 * page,
+		"process_threads":          6,
+		"process_open_fds":         4,
+		"process_cpu_milliseconds": 0,
+		"process_read_bytes":       0,
+		"process_write_bytes":      0,
+	}, processValues(metrics, "workers"))
+	assert.Equal(t, 1.0, processValues(metrics, "mail")["process_count"])
+	assert.Equal(t, 1.0, processValues(metrics, "web")["process_count"])
+	assert.Equal(t, 0.0, processValues(metrics, "gone")["process_count"])
+
+	// Existing processes report the usage since the last poll. A process that
+	// appears after the first poll counts in full, and so does a reused pid.
+	worker.utime += 30
+	worker.stime += 20
+	worker.readBytes += 1000
+	writeProc(t, root, "10", worker)
+	writeProc(t, root, "11", fakeProc{comm: "worker", start: 2000, utime: 7, writeBytes: 50})
+	writeProc(t, root, "13", fakeProc{comm: "worker", start: 2001, stime: 3})
+
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	values := processValues(metrics, "workers")
+	assert.Equal(t, 3.0, values["process_count"])
+	assert.Equal(t, float64((50+7+3)*1000/clockTicks), values["process_cpu_milliseconds"])
+	assert.Equal(t, 1000.0, values["process_read_bytes"])
+	assert.Equal(t, 50.0, values["process_write_bytes"])
+
+	// A malformed stat file skips the process instead of failing the poll.
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "13", "stat"), []byte("13 (worker"), 0644))
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, processValues(metrics, "workers")["process_count"])
+
+	assert.NoError(t, os.WriteFile(pidFile, []byte("nginx"), 0644))
+	_, err = c.Collect(context.Background())
+	assert.ErrorContains(t, err, "invalid pid")
+}
+
+func TestParseProcessSelectorsErrors(t *testing.T) {
+	for _, spec := range []string{"web", "web=nginx", "web=name:", "=name:nginx", "web=exe:nginx", "web=cmdline:("} {
+		_, err := ParseProcessSelectors(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type RenameRule struct {
+	Pattern string
+	Replace string
+}
+
+type PrometheusConfig struct {
+	URLs          []string
+	Drop          []string
+	Rename        []RenameRule
+	FlattenLabels bool
+	Timeout       time.Duration
+}
+
+func ParseRenameRules(spec string) ([]RenameRule, error) {
+	var rules []RenameRule
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		pattern, replace, ok := strings.Cut(item, "=")
+		if !ok || pattern == "" || replace == "" {
+			return nil, fmt.Errorf("rename rule %q: expected pattern=name", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("rename rule %q: %w", item, err)
+		}
+		rules = append(rules, RenameRule{Pattern: pattern, Replace: replace})
+	}
+	return rules, nil
+}
+
+func (r RenameRule) apply(name string) (string, bool) {
+	if ok, _ := path.Match(r.Pattern, name); !ok {
+		return name, false
+	}
+
+	prefix, wildcard := strings.CutSuffix(r.Pattern, "*")
+	replace, replaceWildcard := strings.CutSuffix(r.Replace, "*")
+	if wildcard && replaceWildcard && !strings.ContainsAny(prefix, "*?[") {
+		return replace + strings.TrimPrefix(name, prefix), true
+	}
+	return r.Replace, true
+}
+
+type Prometheus struct {
+	cfg      PrometheusConfig
+	client   *http.Client
+	counters map[string]int64
+	// primed holds the URLs scraped successfully at least once. Counters in
+	// the first scrape only set the baseline, so the exporter's lifetime
+	// totals are not sent as one delta on every agent start.
+	primed map[string]bool
+}
+
+func NewPrometheus(cfg PrometheusConfig) *Prometheus {
+	return &Prometheus{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		counters: make(map[string]int64),
+		primed:   make(map[string]bool),
+	}
+}
+
+func (c *Prometheus) Name() string {
+	return "prometheus"
+}
+
+func (c *Prometheus) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var metrics []models.Metrics
+	var errs []error
+
+	for _, u := range c.cfg.URLs {
+		samples, err := c.fetch(ctx, u)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, s := range samples {
+			if m, ok := c.convert(s, c.primed[u]); ok {
+				metrics = append(metrics, m)
+			}
+		}
+		c.primed[u] = true
+	}
+
+	return metrics, errors.Join(errs...)
+}
+
+func (c *Prometheus) fetch(ctx context.Context, u string) ([]promSample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request for %s: %w", u, err)
+	}
+	req.Header.Set("Accept", "text/plain;version=0.0.4")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("scrape %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("scrape %s: status %d", u, resp.StatusCode)
+	}
+
+	samples, err := parsePromText(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", u, err)
+	}
+	return samples, nil
+}
+
+func (c *Prometheus) dropped(name string) bool {
+	for _, p := range c.cfg.Drop {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func flattenName(name string, ls map[string]string) string {
+	keys := make([]string, 0, len(ls))
+	for k := range ls {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte('_')
+		b.WriteString(k)
+		b.WriteByte('_')
+		b.WriteString(strings.Map(func(r rune) rune {
+			if r == '{' || r == '}' || r == ' ' {
+				return '_'
+			}
+			return r
+		}, ls[k]))
+	}
+	return b.String()
+}
+
+func (c *Prometheus) convert(s promSample, primed bool) (models.Metrics, bool) {
+	if c.dropped(s.name) || math.IsNaN(s.value) || math.IsInf(s.value, 0) {
+		return models.Metrics{}, false
+	}
+
+	name := s.name
+	for _, r := range c.cfg.Rename {
+		if renamed, ok := r.apply(name); ok {
+			name = renamed
+			break
+		}
+	}
+
+	ls := s.labels
+	if len(ls) == 0 {
+		ls = nil
+	}
+	if c.cfg.FlattenLabels && ls != nil {
+		name = flattenName(name, ls)
+		ls = nil
+	}
+
+	if s.mtype != "counter" {
+		return models.Gauge(name, s.value, ls), true
+	}
+
+	key := labels.Key(name, ls)
+	value := int64(math.Round(s.value))
+	delta := value
+	if prev, ok := c.counters[key]; ok && value >= prev {
+		delta = value - prev
+	} else if !ok && !primed {
+		delta = 0
+	}
+	c.counters[key] = value
+
+	return models.Counter(name, delta, ls), true
+}
@@ -0,0 +1,104 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	requests := 15
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `# HELP http_requests_total Requests served.
+# TYPE http_requests_total counter
+http_requests_total{code="200",path="/a \"b\""} %d 1700000000000
+# TYPE temperature gauge
+temperature 21.5
+go_goroutines 7
+queue_depth NaN
+`, requests)
+	}))
+	defer srv.Close()
+
+	rename, err := ParseRenameRules("http_*=web_*, temperature=room_temp")
+	assert.NoError(t, err)
+
+	c := NewPrometheus(PrometheusConfig{
+		URLs:    []string{srv.URL},
+		Drop:    []string{"go_*"},
+		Rename:  rename,
+		Timeout: time.Second,
+	})
+
+	byID := func(metrics []models.Metrics) map[string]models.Metrics {
+		result := make(map[string]models.Metrics)
+		for _, m := range metrics {
+			result[m.ID] = m
+		}
+		return result
+	}
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	got := byID(metrics)
+	assert.Len(t, got, 2)
+
+	// The first scrape only sets the counter baseline.
+	web := got["web_requests_total"]
+	assert.Equal(t, "counter", web.MType)
+	assert.Equal(t, int64(0), *web.Delta)
+	assert.Equal(t, map[string]string{"code": "200", "path": `/a "b"`}, web.Labels)
+
+	room := got["room_temp"]
+	assert.Equal(t, "gauge", room.MType)
+	assert.Equal(t, 21.5, *room.Value)
+
+	requests = 20
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), *byID(metrics)["web_requests_total"].Delta)
+
+	requests = 3
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), *byID(metrics)["web_requests_total"].Delta)
+}
+
+func TestPrometheusFlattenAndErrors(t *testing.T) {
+	body := "up{job=\"api\"} 1\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+
+	c := NewPrometheus(PrometheusConfig{
+		URLs:          []string{srv.URL},
+		FlattenLabels: true,
+		Timeout:       time.Second,
+	})
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, "up_job_api", metrics[0].ID)
+		assert.Nil(t, metrics[0].Labels)
+	}
+
+	for _, bad := range []string{"up{job=\"api\" 1\n", "up{job=api} 1\n", "up one\n", "up 1 2 3\n"} {
+		body = bad
+		_, err := c.Collect(context.Background())
+		assert.Error(t, err, bad)
+	}
+
+	for _, spec := range []string{"http_*", "=x", "[=x"} {
+		_, err := ParseRenameRules(spec)
+		assert.Error(t, err, spec)
+	}
+}
@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type promSample struct {
+	name   string
+	mtype  string
+	labels map[string]string
+	value  float64
+}
+
+func promFamily(name string, types map[string]string) string {
+	if _, ok := types[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count", "_total"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			if _, ok := types[base]; ok {
+				return base
+			}
+		}
+	}
+	return name
+}
+
+func parsePromLabels(s string) (map[string]string, error) {
+	ls := make(map[string]string)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 {
+			return nil, fmt.Errorf("malformed labels near %q", s)
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = strings.TrimSpace(s[eq+1:])
+
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return nil, fmt.Errorf("malformed label value for %q", name)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("malformed label value for %q", name)
+		}
+		ls[name] = value
+
+		s = strings.TrimSpace(s[len(quoted):])
+		s = strings.TrimSpace(strings.TrimPrefix(s, ","))
+	}
+	return ls, nil
+}
+
+func parsePromValue(s string) (float64, error) {
+	switch s {
+	case "+Inf":
+		return math.Inf(1), nil
+	case "-Inf":
+		return math.Inf(-1), nil
+	case "NaN":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func parsePromText(r io.Reader) ([]promSample, error) {
+	types := make(map[string]string)
+	var samples []promSample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = fields[3]
+			}
+			continue
+		}
+
+		var name, rest string
+		var ls map[string]string
+
+		if i := strings.IndexByte(line, '{'); i >= 0 {
+			j := strings.LastIndexByte(line, '}')
+			if j < i {
+				return nil, fmt.Errorf("line %d: unterminated label set", lineNo)
+			}
+			var err error
+			ls, err = parsePromLabels(line[i+1 : j])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			name = line[:i]
+			rest = line[j+1:]
+		} else {
+			name, rest, _ = strings.Cut(line, " ")
+		}
+
+		fields := strings.Fields(rest)
+		if len(fields) < 1 || len(fields) > 2 {
+			return nil, fmt.Errorf("line %d: expected value and optional timestamp", lineNo)
+		}
+		value, err := parsePromValue(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid value %q", lineNo, fields[0])
+		}
+
+		mtype := types[promFamily(name, types)]
+		if mtype == "" {
+			mtype = "untyped"
+		}
+
+		samples = append(samples, promSample{
+			name:   strings.TrimSpace(name),
+			mtype:  mtype,
+			labels: ls,
+			value:  value,
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
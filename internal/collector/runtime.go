@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type Runtime struct{}
+
+func NewRuntime() *Runtime {
+	return &Runtime{}
+}
+
+func (c *Runtime) Name() string {
+	return "runtime"
+}
+
+func (c *Runtime) Collect(ctx context.Context) ([]models.Metrics, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	metrics := []models.Metrics{
+		models.Gauge("RandomValue", rand.Float64(), nil),
+	}
+
+	runtimeMetrics := map[string]float64{
+		"Alloc":         float64(mem.Alloc),
+		"BuckHashSys":   float64(mem.BuckHashSys),
+		"Frees":         float64(mem.Frees),
+		"GCCPUFraction": mem.GCCPUFraction,
+		"GCSys":         float64(mem.GCSys),
+		"HeapAlloc":     float64(mem.HeapAlloc),
+		"HeapIdle":      float64(mem.HeapIdle),
+		"HeapInuse":     float64(mem.HeapInuse),
+		"HeapObjects":   float64(mem.HeapObjects),
+		"HeapReleased":  float64(mem.HeapReleased),
+		"HeapSys":       float64(mem.HeapSys),
+		"LastGC":        float64(mem.LastGC),
+		"Lookups":       float64(mem.Lookups),
+		"MCacheInuse":   float64(mem.MCacheInuse),
+		"MCacheSys":     float64(mem.MCacheSys),
+		"MSpanInuse":    float64(mem.MSpanInuse),
+		"MSpanSys":      float64(mem.MSpanSys),
+		"Mallocs":       float64(mem.Mallocs),
+		"NextGC":        float64(mem.NextGC),
+		"NumForcedGC":   float64(mem.NumForcedGC),
+		"NumGC":         float64(mem.NumGC),
+		"OtherSys":      float64(mem.OtherSys),
+		"PauseTotalNs":  float64(mem.PauseTotalNs),
+		"StackInuse":    float64(mem.StackInuse),
+		"StackSys":      float64(mem.StackSys),
+		"Sys":           float64(mem.Sys),
+		"TotalAlloc":    float64(mem.TotalAlloc),
+	}
+
+	for name, value := range runtimeMetrics {
+		metrics = append(metrics, models.Gauge(name, value, nil))
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"runtime/metrics"
+	"strings"
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+var histogramQuantiles = []struct {
+	suffix string
+	q      float64
+}{
+	{"_p50", 0.50},
+	{"_p95", 0.95},
+	{"_p99", 0.99},
+}
+
+// RuntimeMetrics reads every metric supported by runtime/metrics without
+// stopping the world. Cumulative values are reported as counter deltas,
+// histograms as quantiles over the observations made since the last poll.
+type RuntimeMetrics struct {
+	descs   []metrics.Description
+	samples []metrics.Sample
+
+	mu         sync.Mutex
+	primed     bool
+	prevInts   map[string]uint64
+	prevFloats map[string]int64
+	prevHists  map[string][]uint64
+}
+
+func NewRuntimeMetrics() *RuntimeMetrics {
+	descs := metrics.All()
+	samples := make([]metrics.Sample, len(descs))
+	for i, d := range descs {
+		samples[i].Name = d.Name
+	}
+	return &RuntimeMetrics{
+		descs:      descs,
+		samples:    samples,
+		prevInts:   make(map[string]uint64),
+		prevFloats: make(map[string]int64),
+		prevHists:  make(map[string][]uint64),
+	}
+}
+
+func (c *RuntimeMetrics) Name() string {
+	return "runtime"
+}
+
+func (c *RuntimeMetrics) Collect(ctx context.Context) ([]models.Metrics, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	metrics.Read(c.samples)
+
+	result := []models.Metrics{
+		models.Gauge("RandomValue", rand.Float64(), nil),
+	}
+
+	for i, s := range c.samples {
+		d := c.descs[i]
+		name := runtimeMetricName(d.Name)
+
+		switch s.Value.Kind() {
+		case metrics.KindUint64:
+			v := s.Value.Uint64()
+			if !d.Cumulative {
+				result = append(result, models.Gauge(name, float64(v), nil))
+				continue
+			}
+			if c.primed {
+				result = append(result, models.Counter(name, int64(v-c.prevInts[name]), nil))
+			}
+			c.prevInts[name] = v
+
+		case metrics.KindFloat64:
+			v := s.Value.Float64()
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			if !d.Cumulative {
+				result = append(result, models.Gauge(name, v, nil))
+				continue
+			}
+			// Cumulative floats are seconds; counters carry them as whole
+			// milliseconds.
+			name = strings.TrimSuffix(name, "_seconds") + "_milliseconds"
+			ms := int64(v * 1000)
+			if c.primed {
+				result = append(result, models.Counter(name, ms-c.prevFloats[name], nil))
+			}
+			c.prevFloats[name] = ms
+
+		case metrics.KindFloat64Histogram:
+			h := s.Value.Float64Histogram()
+			prev := c.prevHists[name]
+			delta := make([]uint64, len(h.Counts))
+			var total uint64
+			for j, n := range h.Counts {
+				if j < len(prev) {
+					n -= prev[j]
+				}
+				delta[j] = n
+				total += n
+			}
+			c.prevHists[name] = append(prev[:0], h.Counts...)
+
+			if !c.primed {
+				continue
+			}
+			result = append(result, models.Counter(name+"_count", int64(total), nil))
+			if total == 0 {
+				continue
+			}
+			for _, q := range histogramQuantiles {
+				result = append(result, models.Gauge(name+q.suffix, histogramQuantile(h.Buckets, delta, total, q.q), nil))
+			}
+		}
+	}
+
+	c.primed = true
+	return result, nil
+}
+
+// runtimeMetricName turns "/gc/heap/allocs:bytes" into "go_gc_heap_allocs_bytes".
+func runtimeMetricName(name string) string {
+	var b strings.Builder
+	b.WriteString("go")
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func histogramQuantile(buckets []float64, counts []uint64, total uint64, q float64) float64 {
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen < rank {
+			continue
+		}
+		if upper := buckets[i+1]; !math.IsInf(upper, 1) {
+			return upper
+		}
+		return buckets[i]
+	}
+	return buckets[len(buckets)-1]
+}
@@ -0,0 +1,82 @@
+package collector
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeMetricName(t *testing.T) {
+	for name, want := range map[string]string{
+		"/gc/heap/allocs:bytes":          "go_gc_heap_allocs_bytes",
+		"/gc/heap/allocs-by-size:bytes":  "go_gc_heap_allocs_by_size_bytes",
+		"/cpu/classes/total:cpu-seconds": "go_cpu_classes_total_cpu_seconds",
+		"/sched/goroutines:goroutines":   "go_sched_goroutines_goroutines",
+	} {
+		assert.Equal(t, want, runtimeMetricName(name), name)
+	}
+}
+
+func TestHistogramQuantile(t *testing.T) {
+	buckets := []float64{math.Inf(-1), 1, 2, 4, math.Inf(1)}
+	counts := []uint64{0, 50, 45, 5}
+
+	// Quantiles report the upper bound of the bucket holding the rank.
+	assert.Equal(t, 2.0, histogramQuantile(buckets, counts, 100, 0.50))
+	assert.Equal(t, 4.0, histogramQuantile(buckets, counts, 100, 0.95))
+
+	// The open-ended bucket reports its finite lower bound instead.
+	assert.Equal(t, 4.0, histogramQuantile(buckets, counts, 100, 0.99))
+	assert.Equal(t, 4.0, histogramQuantile([]float64{0, 4, math.Inf(1)}, []uint64{0, 3}, 3, 0.5))
+}
+
+var runtimeSink [][]byte
+
+func TestRuntimeMetricsCollect(t *testing.T) {
+	c := NewRuntimeMetrics()
+
+	byID := func(metrics []models.Metrics) map[string]models.Metrics {
+		result := make(map[string]models.Metrics, len(metrics))
+		for _, m := range metrics {
+			result[m.ID] = m
+		}
+		return result
+	}
+
+	metrics, err := c.Collect(context.Background())
+	assert.NoError(t, err)
+	first := byID(metrics)
+
+	assert.Equal(t, "gauge", first["RandomValue"].MType)
+	assert.Equal(t, "gauge", first["go_sched_goroutines_goroutines"].MType)
+	// Cumulative values need a previous sample before they can be reported.
+	assert.NotContains(t, first, "go_gc_heap_allocs_bytes")
+	assert.NotContains(t, first, "go_gc_heap_allocs_by_size_bytes_count")
+
+	for i := 0; i < 1000; i++ {
+		runtimeSink = append(runtimeSink, make([]byte, 64))
+	}
+	runtimeSink = nil
+
+	metrics, err = c.Collect(context.Background())
+	assert.NoError(t, err)
+	second := byID(metrics)
+
+	allocs := second["go_gc_heap_allocs_bytes"]
+	assert.Equal(t, "counter", allocs.MType)
+	assert.GreaterOrEqual(t, *allocs.Delta, int64(64*1000))
+
+	cpu := second["go_cpu_classes_total_cpu_milliseconds"]
+	assert.Equal(t, "counter", cpu.MType)
+	assert.NotContains(t, second, "go_cpu_classes_total_cpu_seconds")
+
+	sizes := second["go_gc_heap_allocs_by_size_bytes_count"]
+	assert.Equal(t, "counter", sizes.MType)
+	assert.GreaterOrEqual(t, *sizes.Delta, int64(1000))
+	for _, suffix := range []string{"_p50", "_p95", "_p99"} {
+		assert.Equal(t, "gauge", second["go_gc_heap_allocs_by_size_bytes"+suffix].MType, suffix)
+	}
+}
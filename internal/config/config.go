@@ -1,138 +1,399 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
-	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/logging"
 )
 
+const redacted = "[redacted]"
+
 type ServerConfig struct {
-	Address         string
-	StoreInterval   int
-	FileStoragePath string
-	Restore         bool
-	LogLevel        string
+	ConfigFile  string `json:"-" yaml:"-"`
+	WatchConfig bool   `json:"-" yaml:"-"`
+
+	Address           string   `json:"address" yaml:"address"`
+	StoreInterval     Duration `json:"store_interval" yaml:"store_interval"`
+	FileStoragePath   string   `json:"file_storage_path" yaml:"file_storage_path"`
+	Restore           bool     `json:"restore" yaml:"restore"`
+	LogLevel          string   `json:"log_level" yaml:"log_level"`
+	AgentStaleTimeout Duration `json:"agent_stale_timeout" yaml:"agent_stale_timeout"`
+	AdminToken        string   `json:"admin_token" yaml:"admin_token"`
+
+	StatsdUDPAddress    string   `json:"statsd_udp_address" yaml:"statsd_udp_address"`
+	StatsdTCPAddress    string   `json:"statsd_tcp_address" yaml:"statsd_tcp_address"`
+	StatsdFlushInterval Duration `json:"statsd_flush_interval" yaml:"statsd_flush_interval"`
+
+	GraphiteAddress string `json:"graphite_address" yaml:"graphite_address"`
+	IngestTypeRules string `json:"ingest_type_rules" yaml:"ingest_type_rules"`
+
+	ForwardTargets  string `json:"forward_targets" yaml:"forward_targets"`
+	ForwardQueueDir string `json:"forward_queue_dir" yaml:"forward_queue_dir"`
+
+	ScrapeTargets  string   `json:"scrape_targets" yaml:"scrape_targets"`
+	ScrapeInterval Duration `json:"scrape_interval" yaml:"scrape_interval"`
+	ScrapeTimeout  Duration `json:"scrape_timeout" yaml:"scrape_timeout"`
+
+	LogFormat     string `json:"log_format" yaml:"log_format"`
+	LogFile       string `json:"log_file" yaml:"log_file"`
+	LogMaxSize    int    `json:"log_max_size_mb" yaml:"log_max_size_mb"`
+	LogMaxBackups int    `json:"log_max_backups" yaml:"log_max_backups"`
+	LogSample     int    `json:"log_sample" yaml:"log_sample"`
 }
 
 type AgentConfig struct {
-	Address        string
-	PollInterval   int
-	ReportInterval int
-	LogLevel       string
+	ConfigFile  string `json:"-" yaml:"-"`
+	WatchConfig bool   `json:"-" yaml:"-"`
+
+	Address        string   `json:"address" yaml:"address"`
+	PollInterval   Duration `json:"poll_interval" yaml:"poll_interval"`
+	ReportInterval Duration `json:"report_interval" yaml:"report_interval"`
+	LogLevel       string   `json:"log_level" yaml:"log_level"`
+	AgentID        string   `json:"agent_id" yaml:"agent_id"`
+	HostLabel      bool     `json:"host_label" yaml:"host_label"`
+	ListenAddress  string   `json:"listen_address" yaml:"listen_address"`
+	GatewayAddress string   `json:"gateway_address" yaml:"gateway_address"`
+	RuntimeProfile string   `json:"runtime_profile" yaml:"runtime_profile"`
+	AggregateRules string   `json:"aggregate_rules" yaml:"aggregate_rules"`
+
+	PromURLs          string `json:"prom_urls" yaml:"prom_urls"`
+	PromDrop          string `json:"prom_drop" yaml:"prom_drop"`
+	PromRename        string `json:"prom_rename" yaml:"prom_rename"`
+	PromFlattenLabels bool   `json:"prom_flatten_labels" yaml:"prom_flatten_labels"`
+
+	ExecCommands string   `json:"exec_commands" yaml:"exec_commands"`
+	ExecTimeout  Duration `json:"exec_timeout" yaml:"exec_timeout"`
+
+	LogRules     string `json:"logtail_rules" yaml:"logtail_rules"`
+	LogStatePath string `json:"logtail_state_path" yaml:"logtail_state_path"`
+
+	ProcessSelectors string `json:"process_selectors" yaml:"process_selectors"`
+
+	LogFormat     string `json:"log_format" yaml:"log_format"`
+	LogFile       string `json:"log_file" yaml:"log_file"`
+	LogMaxSize    int    `json:"log_max_size_mb" yaml:"log_max_size_mb"`
+	LogMaxBackups int    `json:"log_max_backups" yaml:"log_max_backups"`
 }
 
+// ParseServerConfig builds the server config from the command line and exits
+// on error. With -print-config it prints the effective config and exits.
 func ParseServerConfig() *ServerConfig {
-	var addressFlag string
-	var storeIntervalFlag int
-	var fileStoragePathFlag string
-	var restoreFlag bool
-	var logLevelFlag string
-
-	flag.StringVar(&addressFlag, "a", "localhost:8080", "HTTP server endpoint address")
-	flag.IntVar(&storeIntervalFlag, "i", 300, "store interval in seconds")
-	flag.StringVar(&fileStoragePathFlag, "f", "/tmp/metrics-db.json", "file storage path")
-	flag.BoolVar(&restoreFlag, "r", true, "restore from file on startup")
-	flag.StringVar(&logLevelFlag, "l", "info", "log level (debug, info, warn, error)")
-
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [flags]\n", os.Args[0])
-		flag.PrintDefaults()
-		os.Exit(1)
+	cfg, printConfig, err := loadServerConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
 	}
-
-	flag.Parse()
-
-	if flag.NArg() > 0 {
-		fmt.Fprintf(os.Stderr, "Error: unknown arguments: %v\n", flag.Args())
-		flag.Usage()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	address := getConfigValue("ADDRESS", addressFlag, "localhost:8080")
-	storeInterval := getIntConfigValue("STORE_INTERVAL", storeIntervalFlag, 300)
-	fileStoragePath := getConfigValue("FILE_STORAGE_PATH", fileStoragePathFlag, "/tmp/metrics-db.json")
-	restore := getBoolConfigValue("RESTORE", restoreFlag, true)
-	logLevel := getConfigValue("LOG_LEVEL", logLevelFlag, "info")
+	if printConfig {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cfg.Redacted()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	return cfg
+}
 
-	return &ServerConfig{
-		Address:         address,
-		StoreInterval:   storeInterval,
-		FileStoragePath: fileStoragePath,
-		Restore:         restore,
-		LogLevel:        logLevel,
+func serverOptions(cfg *ServerConfig) []option {
+	return []option{
+		{"a", "ADDRESS", "HTTP server endpoint address", &cfg.Address},
+		{"i", "STORE_INTERVAL", "store interval, e.g. 300s or 5m (bare numbers are seconds, 0 saves synchronously)", &cfg.StoreInterval},
+		{"f", "FILE_STORAGE_PATH", "file storage path (in-memory only when empty)", &cfg.FileStoragePath},
+		{"r", "RESTORE", "restore from file on startup", &cfg.Restore},
+		{"l", "LOG_LEVEL", "log level (trace, debug, info, warn, error)", &cfg.LogLevel},
+		{"agent-stale-timeout", "AGENT_STALE_TIMEOUT", "time without reports after which an agent is stale", &cfg.AgentStaleTimeout},
+		{"admin-token", "ADMIN_TOKEN", "bearer token for admin endpoints (disabled when empty)", &cfg.AdminToken},
+		{"statsd-udp", "STATSD_UDP_ADDRESS", "StatsD UDP listen address (disabled when empty)", &cfg.StatsdUDPAddress},
+		{"statsd-tcp", "STATSD_TCP_ADDRESS", "StatsD TCP listen address (disabled when empty)", &cfg.StatsdTCPAddress},
+		{"statsd-flush", "STATSD_FLUSH_INTERVAL", "StatsD aggregation flush interval", &cfg.StatsdFlushInterval},
+		{"graphite", "GRAPHITE_ADDRESS", "Graphite plaintext TCP listen address (disabled when empty)", &cfg.GraphiteAddress},
+		{"type-rules", "INGEST_TYPE_RULES", "ingest type mapping rules, e.g. \"*.count=counter,*_total=counter\"", &cfg.IngestTypeRules},
+		{"forward", "FORWARD_TARGETS", "upstream servers to forward updates to, e.g. \"http://dc1:8080|Alloc*,http://:token@dc2:8080\"; a URL password is the upstream admin token for deletes and resets", &cfg.ForwardTargets},
+		{"forward-queue-dir", "FORWARD_QUEUE_DIR", "directory for persistent forward queues (in-memory when empty)", &cfg.ForwardQueueDir},
+		{"scrape", "SCRAPE_TARGETS", "agent endpoints to scrape, e.g. \"host1:9091,host2:9091\"", &cfg.ScrapeTargets},
+		{"scrape-interval", "SCRAPE_INTERVAL", "scrape interval", &cfg.ScrapeInterval},
+		{"scrape-timeout", "SCRAPE_TIMEOUT", "per-target scrape timeout", &cfg.ScrapeTimeout},
+		{"log-format", "LOG_FORMAT", "log format: json or console", &cfg.LogFormat},
+		{"log-file", "LOG_FILE", "write logs to this file instead of stdout", &cfg.LogFile},
+		{"log-max-size", "LOG_MAX_SIZE", "rotate the log file after this many megabytes", &cfg.LogMaxSize},
+		{"log-max-backups", "LOG_MAX_BACKUPS", "number of rotated log files to keep", &cfg.LogMaxBackups},
+		{"log-sample", "LOG_SAMPLE", "log one in N successful requests (errors are always logged)", &cfg.LogSample},
 	}
 }
 
-func ParseAgentConfig() *AgentConfig {
-	var addressFlag string
-	var pollIntervalFlag int
-	var reportIntervalFlag int
-	var logLevelFlag string
+// LoadServerConfig combines sources in the same order as LoadAgentConfig:
+// defaults, config file, environment, flags set on the command line.
+// SERVER_PORT is honoured as a fallback for ADDRESS.
+func LoadServerConfig(args []string) (*ServerConfig, error) {
+	cfg, _, err := loadServerConfig(args)
+	return cfg, err
+}
 
-	flag.StringVar(&addressFlag, "a", "localhost:8080", "HTTP server endpoint address")
-	flag.IntVar(&pollIntervalFlag, "p", 2, "metrics poll interval (seconds)")
-	flag.IntVar(&reportIntervalFlag, "r", 10, "metrics report interval (seconds)")
-	flag.StringVar(&logLevelFlag, "l", "info", "log level (debug, info, warn, error)")
+func loadServerConfig(args []string) (*ServerConfig, bool, error) {
+	cfg := &ServerConfig{
+		Address:             "localhost:8080",
+		StoreInterval:       Duration(300 * time.Second),
+		FileStoragePath:     "/tmp/metrics-db.json",
+		Restore:             true,
+		LogLevel:            "info",
+		AgentStaleTimeout:   Duration(time.Minute),
+		StatsdFlushInterval: Duration(10 * time.Second),
+		ForwardQueueDir:     "/tmp/metrics-forward",
+		ScrapeInterval:      Duration(10 * time.Second),
+		ScrapeTimeout:       Duration(5 * time.Second),
+		LogFormat:           "json",
+		LogMaxSize:          100,
+		LogMaxBackups:       3,
+		LogSample:           1,
+	}
+	opts := serverOptions(cfg)
 
-	flag.Parse()
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("c", "", "path to a JSON or YAML config file")
+	watchConfig := fs.Bool("watch-config", false, "reload the config file when it changes, as on SIGHUP")
+	printConfig := fs.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	registerFlags(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, false, err
+	}
+	if fs.NArg() > 0 {
+		return nil, false, fmt.Errorf("unknown arguments: %v", fs.Args())
+	}
 
-	if flag.NArg() > 0 {
-		fmt.Fprintf(os.Stderr, "Error: unknown arguments: %v\n", flag.Args())
-		flag.Usage()
-		os.Exit(1)
+	cfg.ConfigFile = *configFile
+	cfg.WatchConfig = *watchConfig
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile = os.Getenv("CONFIG")
 	}
+	if cfg.ConfigFile != "" {
+		if err := loadFile(cfg.ConfigFile, cfg); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if port := os.Getenv("SERVER_PORT"); port != "" && os.Getenv("ADDRESS") == "" {
+		cfg.Address = "localhost:" + port
+	}
+	if err := errors.Join(applyEnv(opts), applyFlags(fs, opts)); err != nil {
+		return nil, false, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, false, err
+	}
+	return cfg, *printConfig, nil
+}
 
-	address := getConfigValue("ADDRESS", addressFlag, "localhost:8080")
-	pollInterval := getIntConfigValue("POLL_INTERVAL", pollIntervalFlag, 2)
-	reportInterval := getIntConfigValue("REPORT_INTERVAL", reportIntervalFlag, 10)
-	logLevel := getConfigValue("LOG_LEVEL", logLevelFlag, "info")
+func (c *ServerConfig) Validate() error {
+	var errs []error
+	if err := validateAddress("address", c.Address); err != nil {
+		errs = append(errs, err)
+	}
+	for _, l := range []struct{ name, addr string }{
+		{"statsd_udp_address", c.StatsdUDPAddress},
+		{"statsd_tcp_address", c.StatsdTCPAddress},
+		{"graphite_address", c.GraphiteAddress},
+	} {
+		if l.addr == "" {
+			continue
+		}
+		if err := validateAddress(l.name, l.addr); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.StoreInterval < 0 {
+		errs = append(errs, fmt.Errorf("store_interval: must not be negative, got %s", c.StoreInterval))
+	}
+	if err := validatePositive("agent_stale_timeout", c.AgentStaleTimeout); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePositive("statsd_flush_interval", c.StatsdFlushInterval); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePositive("scrape_interval", c.ScrapeInterval); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePositive("scrape_timeout", c.ScrapeTimeout); err != nil {
+		errs = append(errs, err)
+	}
+	if c.LogSample < 1 {
+		errs = append(errs, fmt.Errorf("log_sample: must be at least 1, got %d", c.LogSample))
+	}
+	errs = append(errs, validateLogging(c.Logging()))
+	return errors.Join(errs...)
+}
 
-	return &AgentConfig{
-		Address:        address,
-		PollInterval:   pollInterval,
-		ReportInterval: reportInterval,
-		LogLevel:       logLevel,
+func (c *ServerConfig) Logging() logging.Config {
+	return logging.Config{
+		Level:      c.LogLevel,
+		Format:     c.LogFormat,
+		File:       c.LogFile,
+		MaxSizeMB:  c.LogMaxSize,
+		MaxBackups: c.LogMaxBackups,
 	}
 }
 
-func getConfigValue(envVar, flagValue, defaultValue string) string {
-	if envValue := os.Getenv(envVar); envValue != "" {
-		return envValue
+// Redacted returns a copy that is safe to print: the admin token is masked
+// and passwords are stripped from forward target URLs.
+func (c *ServerConfig) Redacted() ServerConfig {
+	r := *c
+	if r.AdminToken != "" {
+		r.AdminToken = redacted
 	}
 
-	if envVar == "ADDRESS" {
-		if port := os.Getenv("SERVER_PORT"); port != "" {
-			return "localhost:" + port
+	targets := strings.Split(r.ForwardTargets, ",")
+	for i, t := range targets {
+		rawURL, rest, _ := strings.Cut(t, "|")
+		if u, err := url.Parse(rawURL); err == nil && u.User != nil {
+			targets[i] = u.Redacted()
+			if rest != "" {
+				targets[i] += "|" + rest
+			}
 		}
 	}
+	r.ForwardTargets = strings.Join(targets, ",")
+	return r
+}
+
+// ParseAgentConfig builds the agent config from the command line and exits
+// on error. See LoadAgentConfig for how the sources are combined.
+func ParseAgentConfig() *AgentConfig {
+	cfg, err := LoadAgentConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return cfg
+}
 
-	if flagValue != "" && flagValue != defaultValue {
-		return flagValue
+func agentOptions(cfg *AgentConfig) []option {
+	return []option{
+		{"a", "ADDRESS", "HTTP server endpoint address", &cfg.Address},
+		{"p", "POLL_INTERVAL", "metrics poll interval, e.g. 500ms or 2s (bare numbers are seconds)", &cfg.PollInterval},
+		{"r", "REPORT_INTERVAL", "metrics report interval (bare numbers are seconds)", &cfg.ReportInterval},
+		{"l", "LOG_LEVEL", "log level (trace, debug, info, warn, error)", &cfg.LogLevel},
+		{"id", "AGENT_ID", "agent instance ID (defaults to hostname)", &cfg.AgentID},
+		{"host-label", "HOST_LABEL", "attach host and agent labels to reported metrics", &cfg.HostLabel},
+		{"listen", "AGENT_LISTEN_ADDRESS", "address to expose collected metrics for scraping (disabled when empty)", &cfg.ListenAddress},
+		{"gateway", "AGENT_GATEWAY_ADDRESS", "local push gateway address, host:port or unix:/path (disabled when empty)", &cfg.GatewayAddress},
+		{"runtime", "RUNTIME_PROFILE", "runtime metrics profile: memstats (legacy names) or metrics (runtime/metrics)", &cfg.RuntimeProfile},
+		{"aggregate", "AGGREGATE_RULES", "semicolon-separated poll-window aggregations, e.g. \"Heap*=min,max;RandomValue=mean,p95\"", &cfg.AggregateRules},
+		{"prom-urls", "PROM_SCRAPE_URLS", "comma-separated Prometheus text endpoints to relay", &cfg.PromURLs},
+		{"prom-drop", "PROM_DROP", "comma-separated globs of Prometheus metric names to drop", &cfg.PromDrop},
+		{"prom-rename", "PROM_RENAME", "comma-separated rename rules, e.g. \"node_load1=Load1,node_*=host_*\"", &cfg.PromRename},
+		{"prom-flatten", "PROM_FLATTEN_LABELS", "flatten Prometheus labels into metric names", &cfg.PromFlattenLabels},
+		{"exec", "EXEC_COMMANDS", "semicolon-separated checks to run, e.g. \"disk=/usr/local/bin/check_disk\"", &cfg.ExecCommands},
+		{"exec-timeout", "EXEC_TIMEOUT", "per-check timeout", &cfg.ExecTimeout},
+		{"logtail", "LOGTAIL_RULES", "semicolon-separated log rules path|regex|metric|type[|value_group]", &cfg.LogRules},
+		{"logtail-state", "LOGTAIL_STATE_PATH", "file to persist log read offsets in", &cfg.LogStatePath},
+		{"log-format", "LOG_FORMAT", "log format: json or console", &cfg.LogFormat},
+		{"log-file", "LOG_FILE", "write logs to this file instead of stdout", &cfg.LogFile},
+		{"log-max-size", "LOG_MAX_SIZE", "rotate the log file after this many megabytes", &cfg.LogMaxSize},
+		{"log-max-backups", "LOG_MAX_BACKUPS", "number of rotated log files to keep", &cfg.LogMaxBackups},
+		{"procs", "PROCESS_SELECTORS", "semicolon-separated processes to watch, e.g. \"web=name:nginx;db=pidfile:/run/pg.pid;app=cmdline:java.*app\"", &cfg.ProcessSelectors},
 	}
-	return defaultValue
 }
 
-func getIntConfigValue(envVar string, flagValue, defaultValue int) int {
-	if envValue := os.Getenv(envVar); envValue != "" {
-		if val, err := strconv.Atoi(envValue); err == nil {
-			return val
+// LoadAgentConfig combines, from lowest to highest precedence: built-in
+// defaults, the config file given by -c or CONFIG (JSON, or YAML for .yaml
+// and .yml), environment variables and flags set on the command line.
+func LoadAgentConfig(args []string) (*AgentConfig, error) {
+	cfg := &AgentConfig{
+		Address:        "localhost:8080",
+		PollInterval:   Duration(2 * time.Second),
+		ReportInterval: Duration(10 * time.Second),
+		LogLevel:       "info",
+		RuntimeProfile: "memstats",
+		ExecTimeout:    Duration(10 * time.Second),
+		LogStatePath:   "/tmp/agent-logtail-state.json",
+		LogFormat:      "json",
+		LogMaxSize:     100,
+		LogMaxBackups:  3,
+	}
+	opts := agentOptions(cfg)
+
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	configFile := fs.String("c", "", "path to a JSON or YAML config file")
+	watchConfig := fs.Bool("watch-config", false, "reload the config file when it changes, as on SIGHUP")
+	registerFlags(fs, opts)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unknown arguments: %v", fs.Args())
+	}
+
+	cfg.ConfigFile = *configFile
+	cfg.WatchConfig = *watchConfig
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile = os.Getenv("CONFIG")
+	}
+	if cfg.ConfigFile != "" {
+		if err := loadFile(cfg.ConfigFile, cfg); err != nil {
+			return nil, err
 		}
 	}
-	if flagValue != defaultValue {
-		return flagValue
+
+	if err := errors.Join(applyEnv(opts), applyFlags(fs, opts)); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return cfg, nil
 }
 
-func getBoolConfigValue(envVar string, flagValue, defaultValue bool) bool {
-	if envValue := os.Getenv(envVar); envValue != "" {
-		if val, err := strconv.ParseBool(envValue); err == nil {
-			return val
+func (c *AgentConfig) Logging() logging.Config {
+	return logging.Config{
+		Level:      c.LogLevel,
+		Format:     c.LogFormat,
+		File:       c.LogFile,
+		MaxSizeMB:  c.LogMaxSize,
+		MaxBackups: c.LogMaxBackups,
+	}
+}
+
+func (c *AgentConfig) Validate() error {
+	var errs []error
+	if err := validateAddress("address", c.Address); err != nil {
+		errs = append(errs, err)
+	}
+	if c.ListenAddress != "" {
+		if err := validateAddress("listen_address", c.ListenAddress); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.GatewayAddress != "" && !strings.HasPrefix(c.GatewayAddress, "unix:") {
+		if err := validateAddress("gateway_address", c.GatewayAddress); err != nil {
+			errs = append(errs, err)
 		}
 	}
-	if flagValue != defaultValue {
-		return flagValue
+	if err := validatePositive("poll_interval", c.PollInterval); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePositive("report_interval", c.ReportInterval); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validatePositive("exec_timeout", c.ExecTimeout); err != nil {
+		errs = append(errs, err)
+	}
+	if c.RuntimeProfile != "memstats" && c.RuntimeProfile != "metrics" {
+		errs = append(errs, fmt.Errorf("runtime_profile: unknown profile %q", c.RuntimeProfile))
 	}
-	return defaultValue
+	errs = append(errs, validateLogging(c.Logging()))
+	return errors.Join(errs...)
 }
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerConfigExplicitFlag(t *testing.T) {
+	t.Setenv("SERVER_PORT", "9999")
+
+	cfg, err := LoadServerConfig(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:9999", cfg.Address)
+
+	cfg, err = LoadServerConfig([]string{"-a", "localhost:8080", "-f", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, "localhost:8080", cfg.Address)
+	assert.Empty(t, cfg.FileStoragePath)
+
+	cfg.AdminToken = "secret"
+	assert.Equal(t, "[redacted]", cfg.Redacted().AdminToken)
+	assert.Equal(t, "secret", cfg.AdminToken)
+}
+
+func TestAgentConfigPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "agent.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("address: file:1\npoll_interval: 5\nreport_interval: 1m\n"), 0644))
+
+	t.Setenv("CONFIG", path)
+	t.Setenv("POLL_INTERVAL", "7")
+	cfg, err := LoadAgentConfig([]string{"-r", "500ms"})
+	assert.NoError(t, err)
+	assert.Equal(t, "file:1", cfg.Address)
+	assert.Equal(t, Duration(7*time.Second), cfg.PollInterval)
+	assert.Equal(t, Duration(500*time.Millisecond), cfg.ReportInterval)
+
+	assert.NoError(t, os.WriteFile(path, []byte("adress: typo:1\n"), 0644))
+	_, err = LoadAgentConfig(nil)
+	assert.ErrorContains(t, err, "adress")
+
+	t.Setenv("CONFIG", "")
+	_, err = LoadAgentConfig([]string{"-p", "0", "-a", "nope"})
+	assert.ErrorContains(t, err, "poll_interval")
+	assert.ErrorContains(t, err, "address")
+}
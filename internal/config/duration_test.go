@@ -0,0 +1,45 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	tests := []struct {
+		json, yaml string
+		want       Duration
+		wantErr    bool
+	}{
+		{json: `"5"`, yaml: `"5"`, want: Duration(5 * time.Second)},
+		{json: `5`, yaml: `5`, want: Duration(5 * time.Second)},
+		{json: `"1m"`, yaml: `1m`, want: Duration(time.Minute)},
+		{json: `"500ms"`, yaml: `500ms`, want: Duration(500 * time.Millisecond)},
+		{json: `-5`, yaml: `-5`, want: Duration(-5 * time.Second)},
+		{json: `"-1s"`, yaml: `-1s`, want: Duration(-time.Second)},
+		{json: `"soon"`, yaml: `soon`, wantErr: true},
+		{json: `1.5`, yaml: `1.5`, wantErr: true},
+		{json: `true`, yaml: `true`, wantErr: true},
+		{json: `""`, yaml: `""`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var fromJSON, fromYAML Duration
+		jsonErr := json.Unmarshal([]byte(tt.json), &fromJSON)
+		yamlErr := yaml.Unmarshal([]byte(tt.yaml), &fromYAML)
+
+		if tt.wantErr {
+			assert.Error(t, jsonErr, "json %s", tt.json)
+			assert.Error(t, yamlErr, "yaml %s", tt.yaml)
+			continue
+		}
+		assert.NoError(t, jsonErr, "json %s", tt.json)
+		assert.NoError(t, yamlErr, "yaml %s", tt.yaml)
+		assert.Equal(t, tt.want, fromJSON, "json %s", tt.json)
+		assert.Equal(t, tt.want, fromYAML, "yaml %s", tt.yaml)
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// option binds one setting to its flag and environment variable. value points
+// at the config field and holds the default until a source overrides it.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	value any
+}
+
+func registerFlags(fs *flag.FlagSet, opts []option) {
+	for _, o := range opts {
+		switch v := o.value.(type) {
+		case *string:
+			fs.String(o.flag, *v, o.usage)
+		case *int:
+			fs.Int(o.flag, *v, o.usage)
+		case *bool:
+			fs.Bool(o.flag, *v, o.usage)
+		case *Duration:
+			d := *v
+			fs.Var(&d, o.flag, o.usage)
+		}
+	}
+}
+
+func setValue(dst any, s string) error {
+	switch v := dst.(type) {
+	case *string:
+		*v = s
+	case *int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		*v = n
+	case *bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", s)
+		}
+		*v = b
+	case *Duration:
+		return v.Set(s)
+	}
+	return nil
+}
+
+func applyEnv(opts []option) error {
+	var errs []error
+	for _, o := range opts {
+		if s, ok := os.LookupEnv(o.env); ok && s != "" {
+			if err := setValue(o.value, s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", o.env, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// applyFlags copies the flags that were given on the command line, so a flag
+// that happens to equal its default still overrides the file and env.
+func applyFlags(fs *flag.FlagSet, opts []option) error {
+	byName := make(map[string]option, len(opts))
+	for _, o := range opts {
+		byName[o.flag] = o
+	}
+
+	var errs []error
+	fs.Visit(func(f *flag.Flag) {
+		if o, ok := byName[f.Name]; ok {
+			if err := setValue(o.value, f.Value.String()); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// loadFile decodes a JSON or YAML file, chosen by extension, into cfg and
+// rejects keys that do not match a setting.
+func loadFile(path string, cfg any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(cfg); err != nil {
+			return fmt.Errorf("parse config file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func validateAddress(name, addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return fmt.Errorf("%s: invalid address %q", name, addr)
+	}
+	return nil
+}
+
+func validateLogging(c logging.Config) error {
+	var errs []error
+	if _, err := logging.ParseLevel(c.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+	if err := logging.ValidateFormat(c.Format); err != nil {
+		errs = append(errs, fmt.Errorf("log_format: %w", err))
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 {
+		errs = append(errs, errors.New("log_max_size_mb and log_max_backups must not be negative"))
+	}
+	return errors.Join(errs...)
+}
+
+func validatePositive(name string, v Duration) error {
+	if v <= 0 {
+		return fmt.Errorf("%s: must be positive, got %s", name, v)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+func keep[T comparable](rejected *[]string, name string, next *T, cur T) {
+	if *next != cur {
+		*rejected = append(*rejected, name)
+		*next = cur
+	}
+}
+
+// MergeReload returns next with the settings that cannot change while the
+// server runs reset to their current values, and the names of those settings
+// that next tried to change.
+func (c *ServerConfig) MergeReload(next *ServerConfig) (*ServerConfig, []string) {
+	merged := *next
+	var rejected []string
+	keep(&rejected, "address", &merged.Address, c.Address)
+	keep(&rejected, "file_storage_path", &merged.FileStoragePath, c.FileStoragePath)
+	keep(&rejected, "restore", &merged.Restore, c.Restore)
+	keep(&rejected, "statsd_udp_address", &merged.StatsdUDPAddress, c.StatsdUDPAddress)
+	keep(&rejected, "statsd_tcp_address", &merged.StatsdTCPAddress, c.StatsdTCPAddress)
+	keep(&rejected, "statsd_flush_interval", &merged.StatsdFlushInterval, c.StatsdFlushInterval)
+	keep(&rejected, "graphite_address", &merged.GraphiteAddress, c.GraphiteAddress)
+	keep(&rejected, "forward_targets", &merged.ForwardTargets, c.ForwardTargets)
+	keep(&rejected, "forward_queue_dir", &merged.ForwardQueueDir, c.ForwardQueueDir)
+	keep(&rejected, "scrape_targets", &merged.ScrapeTargets, c.ScrapeTargets)
+	keep(&rejected, "scrape_interval", &merged.ScrapeInterval, c.ScrapeInterval)
+	keep(&rejected, "scrape_timeout", &merged.ScrapeTimeout, c.ScrapeTimeout)
+	keep(&rejected, "log_format", &merged.LogFormat, c.LogFormat)
+	keep(&rejected, "log_file", &merged.LogFile, c.LogFile)
+	keep(&rejected, "log_max_size_mb", &merged.LogMaxSize, c.LogMaxSize)
+	keep(&rejected, "log_max_backups", &merged.LogMaxBackups, c.LogMaxBackups)
+	keep(&rejected, "log_sample", &merged.LogSample, c.LogSample)
+	return &merged, rejected
+}
+
+// MergeReload is the agent counterpart of ServerConfig.MergeReload.
+func (c *AgentConfig) MergeReload(next *AgentConfig) (*AgentConfig, []string) {
+	merged := *next
+	var rejected []string
+	keep(&rejected, "agent_id", &merged.AgentID, c.AgentID)
+	keep(&rejected, "listen_address", &merged.ListenAddress, c.ListenAddress)
+	keep(&rejected, "gateway_address", &merged.GatewayAddress, c.GatewayAddress)
+	keep(&rejected, "log_format", &merged.LogFormat, c.LogFormat)
+	keep(&rejected, "log_file", &merged.LogFile, c.LogFile)
+	keep(&rejected, "log_max_size_mb", &merged.LogMaxSize, c.LogMaxSize)
+	keep(&rejected, "log_max_backups", &merged.LogMaxBackups, c.LogMaxBackups)
+	return &merged, rejected
+}
+
+// WatchFile calls onChange whenever the modification time or size of path
+// changes, checking every interval until ctx is done.
+func WatchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	var last os.FileInfo
+	if info, err := os.Stat(path); err == nil {
+		last = info
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			if last == nil || !info.ModTime().Equal(last.ModTime()) || info.Size() != last.Size() {
+				last = info
+				onChange()
+			}
+		}
+	}
+}
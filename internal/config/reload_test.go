@@ -0,0 +1,35 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{}`), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go WatchFile(ctx, path, 5*time.Millisecond, func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	assert.NoError(t, os.WriteFile(path, []byte(`{"log_level":"debug"}`), 0600))
+
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchFile did not report the change")
+	}
+}
@@ -0,0 +1,399 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const (
+	batchSize    = 100
+	maxQueueSize = 100000
+	inboxSize    = 4096
+	pollInterval = time.Second
+	maxBackoff   = 30 * time.Second
+)
+
+var errRejected = errors.New("metric rejected by upstream")
+
+// Op is the operation a forwarded item replays on the upstream server.
+type Op string
+
+const (
+	OpUpdate Op = ""
+	OpDelete Op = "delete"
+	OpReset  Op = "reset"
+)
+
+type Target struct {
+	URL      string
+	Patterns []string
+}
+
+func ParseTargets(spec string) ([]Target, error) {
+	var targets []Target
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, "|")
+		u, err := url.Parse(parts[0])
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid forward target %q", parts[0])
+		}
+
+		t := Target{URL: strings.TrimSuffix(parts[0], "/")}
+		for _, p := range parts[1:] {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid filter %q for %s: %w", p, t.URL, err)
+			}
+			t.Patterns = append(t.Patterns, p)
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
+
+func (t Target) accepts(m models.Metrics) bool {
+	if len(t.Patterns) == 0 {
+		return true
+	}
+	for _, p := range t.Patterns {
+		if ok, _ := path.Match(p, m.ID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type Status struct {
+	URL         string    `json:"url"`
+	Patterns    []string  `json:"patterns,omitempty"`
+	Queued      int       `json:"queued"`
+	Sent        uint64    `json:"sent"`
+	Failed      uint64    `json:"failed"`
+	Dropped     uint64    `json:"dropped"`
+	LagSeconds  float64   `json:"lag_seconds"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastSuccess time.Time `json:"last_success"`
+}
+
+type pending struct {
+	op       Op
+	metric   models.Metrics
+	enqueued time.Time
+}
+
+type target struct {
+	Target
+	queue  *queue
+	inbox  chan pending
+	wake   chan struct{}
+	client *http.Client
+	logger zerolog.Logger
+
+	mu          sync.Mutex
+	sent        uint64
+	failed      uint64
+	rejected    uint64
+	overflow    uint64
+	lastError   string
+	lastSuccess time.Time
+}
+
+type Forwarder struct {
+	targets []*target
+	logger  zerolog.Logger
+}
+
+func queuePath(dir, targetURL string) string {
+	if dir == "" {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write([]byte(targetURL))
+	return filepath.Join(dir, fmt.Sprintf("%x.jsonl", h.Sum64()))
+}
+
+func New(targets []Target, queueDir string, logger zerolog.Logger) (*Forwarder, error) {
+	f := &Forwarder{logger: logger}
+
+	for _, t := range targets {
+		q, err := openQueue(queuePath(queueDir, t.URL), maxQueueSize)
+		if err != nil {
+			return nil, fmt.Errorf("open queue for %s: %w", t.URL, err)
+		}
+		f.targets = append(f.targets, &target{
+			Target: t,
+			queue:  q,
+			inbox:  make(chan pending, inboxSize),
+			wake:   make(chan struct{}, 1),
+			client: &http.Client{Timeout: 10 * time.Second},
+			logger: logger.With().Str("target", t.URL).Logger(),
+		})
+	}
+
+	return f, nil
+}
+
+// Enqueue hands m to the background writer of every target that accepts it.
+// It never blocks: when a writer falls behind, the update is counted as
+// dropped for that target.
+func (f *Forwarder) Enqueue(m models.Metrics) {
+	f.EnqueueOp(OpUpdate, m)
+}
+
+// EnqueueOp is like Enqueue for deletes and resets. Upstream servers guard
+// those with their admin token, which is taken from the password of the
+// target URL, e.g. "http://:token@dc1:8080".
+func (f *Forwarder) EnqueueOp(op Op, m models.Metrics) {
+	p := pending{op: op, metric: m, enqueued: time.Now()}
+	for _, t := range f.targets {
+		if !t.accepts(m) {
+			continue
+		}
+		select {
+		case t.inbox <- p:
+		default:
+			t.mu.Lock()
+			t.overflow++
+			t.mu.Unlock()
+		}
+	}
+}
+
+func (f *Forwarder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range f.targets {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			t.write(ctx)
+		}()
+		go func() {
+			defer wg.Done()
+			t.run(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// write moves updates from the inbox into the persistent queue. On shutdown
+// it persists whatever is still in the inbox before closing the queue file.
+func (t *target) write(ctx context.Context) {
+	persist := func(p pending) {
+		if err := t.queue.push(p.metric, p.op, p.enqueued); err != nil {
+			t.logger.Error().Err(err).Msg("failed to persist forward queue")
+		}
+	}
+
+	for {
+		select {
+		case p := <-t.inbox:
+			persist(p)
+			select {
+			case t.wake <- struct{}{}:
+			default:
+			}
+		case <-ctx.Done():
+			for {
+				select {
+				case p := <-t.inbox:
+					persist(p)
+				default:
+					if err := t.queue.close(); err != nil {
+						t.logger.Error().Err(err).Msg("failed to close forward queue")
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (f *Forwarder) Status() []Status {
+	now := time.Now()
+	result := make([]Status, 0, len(f.targets))
+
+	for _, t := range f.targets {
+		queued, oldest, dropped := t.queue.stats()
+
+		t.mu.Lock()
+		st := Status{
+			URL:         t.URL,
+			Patterns:    t.Patterns,
+			Queued:      queued,
+			Sent:        t.sent,
+			Failed:      t.failed,
+			Dropped:     dropped + t.rejected + t.overflow,
+			LastError:   t.lastError,
+			LastSuccess: t.lastSuccess,
+		}
+		t.mu.Unlock()
+
+		if queued > 0 {
+			st.LagSeconds = now.Sub(oldest).Seconds()
+		}
+		result = append(result, st)
+	}
+	return result
+}
+
+func (t *target) run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	backoff := time.Duration(0)
+
+	for {
+		if backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.wake:
+			case <-ticker.C:
+			}
+		}
+
+		if err := t.drain(ctx); err != nil {
+			t.mu.Lock()
+			t.failed++
+			t.lastError = err.Error()
+			t.mu.Unlock()
+
+			backoff = min(max(2*backoff, 100*time.Millisecond), maxBackoff)
+			t.logger.Warn().Err(err).Dur("backoff", backoff).Msg("failed to forward metrics, retrying")
+			continue
+		}
+		backoff = 0
+	}
+}
+
+func (t *target) drain(ctx context.Context) error {
+	for {
+		batch := t.queue.peek(batchSize)
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for i, it := range batch {
+			err := t.send(ctx, it.Op, it.Metric)
+			if errors.Is(err, errRejected) {
+				t.mu.Lock()
+				t.rejected++
+				t.mu.Unlock()
+				t.logger.Warn().Str("metric", it.Metric.ID).Msg("upstream rejected metric, dropping")
+				continue
+			}
+			if err != nil {
+				if i > 0 {
+					if ackErr := t.queue.ack(batch[i-1].Seq); ackErr != nil {
+						t.logger.Error().Err(ackErr).Msg("failed to persist forward queue")
+					}
+				}
+				return err
+			}
+
+			t.mu.Lock()
+			t.sent++
+			t.lastSuccess = time.Now()
+			t.mu.Unlock()
+		}
+
+		if err := t.queue.ack(batch[len(batch)-1].Seq); err != nil {
+			t.logger.Error().Err(err).Msg("failed to persist forward queue")
+		}
+	}
+}
+
+func (t *target) send(ctx context.Context, op Op, m models.Metrics) error {
+	req, err := t.newRequest(ctx, op, m)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send metric %s: %w", m.ID, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound && op != OpUpdate:
+		// Nothing to delete or reset upstream.
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return errRejected
+	default:
+		return fmt.Errorf("response for %s: %d", m.ID, resp.StatusCode)
+	}
+}
+
+func (t *target) newRequest(ctx context.Context, op Op, m models.Metrics) (*http.Request, error) {
+	var method, target string
+	var body io.Reader
+
+	switch op {
+	case OpUpdate:
+		data, err := json.Marshal(m)
+		if err != nil {
+			return nil, errRejected
+		}
+		method, target, body = http.MethodPost, t.URL+"/update/", bytes.NewReader(data)
+	case OpDelete:
+		method, target = http.MethodDelete, t.URL+"/value/"+m.MType+"/"+metricPath(m)
+	case OpReset:
+		method, target = http.MethodPost, t.URL+"/reset/counter/"+metricPath(m)
+	default:
+		return nil, errRejected
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if op == OpUpdate {
+		req.Header.Set("Content-Type", "application/json")
+	} else if token, ok := req.URL.User.Password(); ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
+
+// metricPath is the escaped name of m followed by its labels as query
+// parameters.
+func metricPath(m models.Metrics) string {
+	p := url.PathEscape(m.ID)
+	if len(m.Labels) == 0 {
+		return p
+	}
+	q := url.Values{}
+	for k, v := range m.Labels {
+		q.Set("label."+k, v)
+	}
+	return p + "?" + q.Encode()
+}
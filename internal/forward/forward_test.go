@@ -0,0 +1,171 @@
+package forward
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func gauge(id string) models.Metrics {
+	v := 1.0
+	return models.Metrics{ID: id, MType: "gauge", Value: &v}
+}
+
+func seqs(items []item) []uint64 {
+	var result []uint64
+	for _, it := range items {
+		result = append(result, it.Seq)
+	}
+	return result
+}
+
+func TestQueuePersistsAcks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.jsonl")
+	q, err := openQueue(path, 10)
+	assert.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.push(gauge(id), OpUpdate, time.Now()))
+	}
+	batch := q.peek(2)
+	assert.Equal(t, []uint64{1, 2}, seqs(batch))
+	assert.NoError(t, q.ack(batch[1].Seq))
+	assert.NoError(t, q.close())
+
+	q, err = openQueue(path, 10)
+	assert.NoError(t, err)
+	rest := q.peek(10)
+	assert.Len(t, rest, 1)
+	assert.Equal(t, "c", rest[0].Metric.ID)
+
+	assert.NoError(t, q.push(gauge("d"), OpUpdate, time.Now()))
+	assert.Equal(t, []uint64{3, 4}, seqs(q.peek(10)))
+}
+
+func TestQueueOverflowDropsOldest(t *testing.T) {
+	q, err := openQueue(filepath.Join(t.TempDir(), "q.jsonl"), 3)
+	assert.NoError(t, err)
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.NoError(t, q.push(gauge(id), OpUpdate, time.Now()))
+	}
+	batch := q.peek(3)
+
+	// The queue overflows while the batch is in flight; acking it must not
+	// take the newer item with it.
+	assert.NoError(t, q.push(gauge("d"), OpUpdate, time.Now()))
+	assert.NoError(t, q.ack(batch[len(batch)-1].Seq))
+
+	rest := q.peek(10)
+	assert.Len(t, rest, 1)
+	assert.Equal(t, "d", rest[0].Metric.ID)
+
+	queued, _, dropped := q.stats()
+	assert.Equal(t, 1, queued)
+	assert.Equal(t, uint64(1), dropped)
+}
+
+func TestQueueCompactsDeadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.jsonl")
+	q, err := openQueue(path, 0)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2*compactMin; i++ {
+		assert.NoError(t, q.push(gauge("m"), OpUpdate, time.Now()))
+	}
+	batch := q.peek(2 * compactMin)
+	assert.NoError(t, q.ack(batch[len(batch)-1].Seq))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestQueueKeepsSequenceAfterAckingAll(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "q.jsonl")
+	q, err := openQueue(path, 0)
+	assert.NoError(t, err)
+
+	for i := 0; i < compactMin+100; i++ {
+		assert.NoError(t, q.push(gauge("m"), OpUpdate, time.Now()))
+	}
+	batch := q.peek(compactMin + 100)
+	assert.NoError(t, q.ack(batch[len(batch)-1].Seq))
+	assert.NoError(t, q.close())
+
+	q, err = openQueue(path, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, q.push(gauge("after"), OpUpdate, time.Now()))
+	assert.NoError(t, q.close())
+
+	q, err = openQueue(path, 0)
+	assert.NoError(t, err)
+	rest := q.peek(10)
+	if assert.Len(t, rest, 1) {
+		assert.Equal(t, "after", rest[0].Metric.ID)
+		assert.Equal(t, uint64(compactMin+101), rest[0].Seq)
+	}
+}
+
+func TestForwarderRetriesUntilDelivered(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var received []string
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var m models.Metrics
+		json.NewDecoder(r.Body).Decode(&m)
+		if m.ID == "bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, m.ID)
+	}))
+	defer upstream.Close()
+
+	f, err := New([]Target{{URL: upstream.URL}}, t.TempDir(), zerolog.Nop())
+	assert.NoError(t, err)
+
+	for _, id := range []string{"a", "bad", "b", "c"} {
+		f.Enqueue(gauge(id))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"a", "b", "c"}, received)
+	st := f.Status()[0]
+	assert.Equal(t, uint64(3), st.Sent)
+	assert.Equal(t, uint64(2), st.Failed)
+	assert.Equal(t, uint64(1), st.Dropped)
+	assert.Zero(t, st.Queued)
+}
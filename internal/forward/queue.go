@@ -0,0 +1,254 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+// compactMin is the number of dead lines (acked or dropped items) the queue
+// file may hold before it is rewritten with only the live items.
+const compactMin = 1024
+
+type item struct {
+	Seq      uint64         `json:"seq"`
+	Op       Op             `json:"op,omitempty"`
+	Metric   models.Metrics `json:"metric"`
+	Enqueued time.Time      `json:"enqueued"`
+}
+
+// queue is a bounded FIFO persisted as an append-only JSONL file. The
+// sequence number of the last acknowledged item lives in a separate small
+// file, so neither acking nor dropping the oldest item rewrites the queue;
+// dead lines are compacted away once they outnumber the live ones.
+type queue struct {
+	mu        sync.Mutex
+	items     []item
+	nextSeq   uint64
+	path      string
+	file      *os.File
+	fileLines int
+	maxSize   int
+	dropped   uint64
+	closed    bool
+}
+
+func openQueue(path string, maxSize int) (*queue, error) {
+	q := &queue{path: path, maxSize: maxSize, nextSeq: 1}
+	if path == "" {
+		return q, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create queue directory: %w", err)
+	}
+
+	var acked uint64
+	if data, err := os.ReadFile(q.ackPath()); err == nil {
+		acked, _ = strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	}
+
+	if err := q.load(acked); err != nil {
+		return nil, err
+	}
+	// Compaction empties the file once everything is acked, so the ack file
+	// is the only record of how far the sequence got.
+	q.nextSeq = max(q.nextSeq, acked+1)
+	if len(q.items) > q.maxSize && q.maxSize > 0 {
+		over := len(q.items) - q.maxSize
+		q.items = q.items[over:]
+		q.dropped += uint64(over)
+	}
+
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *queue) ackPath() string {
+	return q.path + ".ack"
+}
+
+func (q *queue) load(acked uint64) error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open queue file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var it item
+		if err := json.Unmarshal(scanner.Bytes(), &it); err != nil {
+			continue
+		}
+		if it.Seq == 0 {
+			it.Seq = q.nextSeq
+		}
+		q.nextSeq = max(q.nextSeq, it.Seq+1)
+		if it.Seq > acked {
+			q.items = append(q.items, it)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read queue file: %w", err)
+	}
+	return nil
+}
+
+// push appends m to the queue, dropping the oldest item when it is full.
+func (q *queue) push(m models.Metrics, op Op, enqueued time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	it := item{Seq: q.nextSeq, Op: op, Metric: m, Enqueued: enqueued}
+	q.nextSeq++
+
+	q.items = append(q.items, it)
+	if q.maxSize > 0 && len(q.items) > q.maxSize {
+		q.items = q.items[1:]
+		q.dropped++
+	}
+
+	if q.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	if _, err := q.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	q.fileLines++
+	return q.maybeCompact()
+}
+
+func (q *queue) peek(n int) []item {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n = min(n, len(q.items))
+	batch := make([]item, n)
+	copy(batch, q.items[:n])
+	return batch
+}
+
+// ack removes every item up to and including seq. Items dropped in the
+// meantime are simply no longer there, so nothing unsent is lost.
+func (q *queue) ack(seq uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for n < len(q.items) && q.items[n].Seq <= seq {
+		n++
+	}
+	q.items = q.items[n:]
+
+	if q.path == "" {
+		return nil
+	}
+	if err := writeFileAtomic(q.ackPath(), []byte(strconv.FormatUint(seq, 10))); err != nil {
+		return err
+	}
+	return q.maybeCompact()
+}
+
+func (q *queue) maybeCompact() error {
+	if q.closed {
+		return nil
+	}
+	dead := q.fileLines - len(q.items)
+	if dead < compactMin || dead < len(q.items) {
+		return nil
+	}
+	return q.compact()
+}
+
+// compact rewrites the queue file with only the live items and reopens it
+// for appending. The caller holds q.mu unless the queue is not shared yet.
+func (q *queue) compact() error {
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+
+	tmp := q.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, it := range q.items {
+		if err := enc.Encode(it); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return err
+	}
+
+	q.file, err = os.OpenFile(q.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("open queue file: %w", err)
+	}
+	q.fileLines = len(q.items)
+	return nil
+}
+
+func (q *queue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
+
+func (q *queue) stats() (int, time.Time, uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var oldest time.Time
+	if len(q.items) > 0 {
+		oldest = q.items[0].Enqueued
+	}
+	return len(q.items), oldest, q.dropped
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,143 @@
+package ingest
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+)
+
+func ParseGraphiteLine(line string, rules TypeRules) (models.Metrics, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 || len(fields) > 3 {
+		return models.Metrics{}, fmt.Errorf("expected \"path value [timestamp]\", got %d fields", len(fields))
+	}
+
+	parts := strings.Split(fields[0], ";")
+	name := parts[0]
+	if name == "" {
+		return models.Metrics{}, errors.New("empty metric path")
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range parts[1:] {
+		k, v, ok := strings.Cut(tag, "=")
+		if !ok || k == "" {
+			return models.Metrics{}, fmt.Errorf("malformed tag %q", tag)
+		}
+		tags[k] = v
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return models.Metrics{}, fmt.Errorf("invalid value %q", fields[1])
+	}
+
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return models.Metrics{}, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+	}
+
+	return newMetric(name, value, tags, rules)
+}
+
+type GraphiteListener struct {
+	addr   string
+	sink   Sink
+	logger zerolog.Logger
+
+	mu    sync.RWMutex
+	rules TypeRules
+}
+
+func NewGraphiteListener(addr string, rules TypeRules, sink Sink, logger zerolog.Logger) *GraphiteListener {
+	return &GraphiteListener{
+		addr:   addr,
+		sink:   sink,
+		logger: logger,
+		rules:  rules,
+	}
+}
+
+func (l *GraphiteListener) SetTypeRules(rules TypeRules) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = rules
+}
+
+func (l *GraphiteListener) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.addr)
+	if err != nil {
+		return err
+	}
+
+	l.logger.Info().Str("address", l.addr).Msg("graphite listener starting")
+
+	stop := context.AfterFunc(ctx, func() {
+		ln.Close()
+	})
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serve(ctx, conn)
+		}()
+	}
+}
+
+func (l *GraphiteListener) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	remote := conn.RemoteAddr().String()
+	scanner := bufio.NewScanner(conn)
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		l.mu.RLock()
+		rules := l.rules
+		l.mu.RUnlock()
+
+		m, err := ParseGraphiteLine(line, rules)
+		if err == nil {
+			_, err = l.sink.Apply(m)
+		}
+		if err != nil {
+			l.logger.Warn().
+				Err(LineError{Line: lineNo, Err: err}).
+				Str("remote_addr", remote).
+				Msg("rejected graphite line")
+		}
+	}
+}
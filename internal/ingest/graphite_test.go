@@ -0,0 +1,13 @@
+package ingest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphiteSanitizesTagNames(t *testing.T) {
+	m, err := ParseGraphiteLine("cpu.load;host-name=a 1.5", TypeRules{})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"host_name": "a"}, m.Labels)
+}
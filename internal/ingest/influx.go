@@ -0,0 +1,174 @@
+package ingest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+const maxInfluxLineSize = 1 << 20
+
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	start := 0
+	inQuotes := false
+
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`, ="\`, s[i+1]) >= 0 {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func parseInfluxValue(raw string) (float64, bool, error) {
+	switch raw {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	if strings.HasPrefix(raw, `"`) {
+		if len(raw) < 2 || !strings.HasSuffix(raw, `"`) {
+			return 0, false, fmt.Errorf("unterminated string value %s", raw)
+		}
+		return 0, false, nil
+	}
+
+	if n, ok := strings.CutSuffix(raw, "i"); ok {
+		v, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid integer value %q", raw)
+		}
+		return float64(v), true, nil
+	}
+	if n, ok := strings.CutSuffix(raw, "u"); ok {
+		v, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid unsigned value %q", raw)
+		}
+		return float64(v), true, nil
+	}
+
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid float value %q", raw)
+	}
+	return v, true, nil
+}
+
+func ParseInfluxLine(line string, rules TypeRules) ([]models.Metrics, error) {
+	sections := splitUnescaped(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.New("expected \"measurement[,tags] fields [timestamp]\"")
+	}
+
+	if len(sections) == 3 {
+		if _, err := strconv.ParseInt(sections[2], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", sections[2])
+		}
+	}
+
+	head := splitUnescaped(sections[0], ',', false)
+	measurement := unescape(head[0])
+	if measurement == "" {
+		return nil, errors.New("empty measurement")
+	}
+
+	tags := make(map[string]string)
+	for _, tag := range head[1:] {
+		kv := splitUnescaped(tag, '=', false)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("malformed tag %q", tag)
+		}
+		tags[unescape(kv[0])] = unescape(kv[1])
+	}
+
+	var result []models.Metrics
+	for _, field := range splitUnescaped(sections[1], ',', true) {
+		kv := splitUnescaped(field, '=', true)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("malformed field %q", field)
+		}
+
+		value, numeric, err := parseInfluxValue(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		if !numeric {
+			continue
+		}
+
+		name := measurement
+		if key := unescape(kv[0]); key != "value" {
+			name += "_" + key
+		}
+
+		m, err := newMetric(name, value, tags, rules)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+func ParseInflux(r io.Reader, rules TypeRules) ([]LineMetric, []error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxInfluxLineSize)
+
+	var result []LineMetric
+	var errs []error
+	lineNo := 0
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		metrics, err := ParseInfluxLine(line, rules)
+		if err != nil {
+			errs = append(errs, LineError{Line: lineNo, Err: err})
+			continue
+		}
+		for _, m := range metrics {
+			result = append(result, LineMetric{Line: lineNo, Metric: m})
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, LineError{Line: lineNo + 1, Err: err})
+	}
+
+	return result, errs
+}
@@ -0,0 +1,36 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfluxLineErrors(t *testing.T) {
+	rules, err := ParseTypeRules("*_total=counter")
+	assert.NoError(t, err)
+
+	body := "cpu,host=a usage=0.5\nbroken\nhttp requests_total=3i\n"
+	metrics, errs := ParseInflux(strings.NewReader(body), rules)
+
+	assert.Len(t, metrics, 2)
+	assert.Equal(t, 1, metrics[0].Line)
+	assert.Equal(t, "gauge", metrics[0].Metric.MType)
+	assert.Equal(t, 3, metrics[1].Line)
+	assert.Equal(t, "counter", metrics[1].Metric.MType)
+	assert.Equal(t, int64(3), *metrics[1].Metric.Delta)
+
+	assert.Len(t, errs, 1)
+	var lineErr LineError
+	assert.ErrorAs(t, errs[0], &lineErr)
+	assert.Equal(t, 2, lineErr.Line)
+}
+
+func TestInfluxSanitizesTagNames(t *testing.T) {
+	metrics, errs := ParseInflux(strings.NewReader("cpu,host-name=a,dc.zone=eu usage=1\n"), TypeRules{})
+	assert.Empty(t, errs)
+	if assert.Len(t, metrics, 1) {
+		assert.Equal(t, map[string]string{"host_name": "a", "dc_zone": "eu"}, metrics[0].Metric.Labels)
+	}
+}
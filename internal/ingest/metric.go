@@ -0,0 +1,65 @@
+package ingest
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type Sink interface {
+	Apply(m models.Metrics) (models.Metrics, error)
+}
+
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e LineError) Unwrap() error {
+	return e.Err
+}
+
+// LineMetric is a parsed metric together with the line it came from, so
+// errors applying it can still be reported against the source line.
+type LineMetric struct {
+	Line   int
+	Metric models.Metrics
+}
+
+func sanitizeTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	ls := make(map[string]string, len(tags))
+	for k, v := range tags {
+		ls[labels.SanitizeName(k)] = v
+	}
+	return ls
+}
+
+func newMetric(name string, value float64, tags map[string]string, rules TypeRules) (models.Metrics, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return models.Metrics{}, fmt.Errorf("non-finite value for %q", name)
+	}
+	m := models.Metrics{
+		ID:     name,
+		MType:  rules.Resolve(name),
+		Labels: sanitizeTags(tags),
+	}
+	if m.MType == "counter" {
+		if value != math.Trunc(value) {
+			return models.Metrics{}, fmt.Errorf("counter %q requires an integer value, got %v", name, value)
+		}
+		delta := int64(value)
+		m.Delta = &delta
+	} else {
+		m.Value = &value
+	}
+	return m, nil
+}
@@ -0,0 +1,49 @@
+package ingest
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+type typeRule struct {
+	pattern string
+	mtype   string
+}
+
+type TypeRules struct {
+	rules []typeRule
+}
+
+func ParseTypeRules(spec string) (TypeRules, error) {
+	var tr TypeRules
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pattern, mtype, ok := strings.Cut(item, "=")
+		if !ok {
+			return TypeRules{}, fmt.Errorf("type rule %q: expected pattern=type", item)
+		}
+		if mtype != "gauge" && mtype != "counter" {
+			return TypeRules{}, fmt.Errorf("type rule %q: unknown type %q", item, mtype)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return TypeRules{}, fmt.Errorf("type rule %q: %w", item, err)
+		}
+
+		tr.rules = append(tr.rules, typeRule{pattern: pattern, mtype: mtype})
+	}
+	return tr, nil
+}
+
+func (tr TypeRules) Resolve(name string) string {
+	for _, r := range tr.rules {
+		if ok, _ := path.Match(r.pattern, name); ok {
+			return r.mtype
+		}
+	}
+	return "gauge"
+}
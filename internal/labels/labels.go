@@ -0,0 +1,181 @@
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+func ValidateName(name string) error {
+	if strings.ContainsAny(name, "{}") {
+		return fmt.Errorf("metric name %q must not contain braces", name)
+	}
+	return nil
+}
+
+func Validate(ls map[string]string) error {
+	for name := range ls {
+		if !labelNameRe.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// SanitizeName replaces every character that is not allowed in a label name
+// with an underscore, so names like "host-name" or "dc.zone" become valid.
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9' && i > 0:
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func Key(name string, ls map[string]string) string {
+	if len(ls) == 0 {
+		return name
+	}
+
+	names := make([]string, 0, len(ls))
+	for k := range ls {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(ls[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+func Split(key string) (string, map[string]string, error) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 {
+		return key, nil, nil
+	}
+	if !strings.HasSuffix(key, "}") {
+		return "", nil, fmt.Errorf("unterminated label set in %q", key)
+	}
+
+	name := key[:i]
+	rest := key[i+1 : len(key)-1]
+	ls := make(map[string]string)
+
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return "", nil, fmt.Errorf("malformed label set in %q", key)
+		}
+		lname := rest[:eq]
+		rest = rest[eq+1:]
+
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return "", nil, fmt.Errorf("malformed label value in %q: %w", key, err)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, fmt.Errorf("malformed label value in %q: %w", key, err)
+		}
+		ls[lname] = value
+
+		rest = strings.TrimPrefix(rest[len(quoted):], ",")
+	}
+
+	return name, ls, nil
+}
+
+type Matcher struct {
+	Name  string
+	Op    string
+	Value string
+	re    *regexp.Regexp
+}
+
+var errEmptyMatcher = errors.New("empty label matcher")
+
+func ParseMatcher(s string) (Matcher, error) {
+	if s == "" {
+		return Matcher{}, errEmptyMatcher
+	}
+
+	for _, op := range []string{"!=", "=~", "!~", "="} {
+		i := strings.Index(s, op)
+		if i <= 0 {
+			continue
+		}
+
+		m := Matcher{Name: s[:i], Op: op, Value: s[i+len(op):]}
+		if !labelNameRe.MatchString(m.Name) {
+			return Matcher{}, fmt.Errorf("invalid label name %q in matcher", m.Name)
+		}
+		if op == "=~" || op == "!~" {
+			re, err := regexp.Compile("^(?:" + m.Value + ")$")
+			if err != nil {
+				return Matcher{}, fmt.Errorf("invalid regexp in matcher %q: %w", s, err)
+			}
+			m.re = re
+		}
+		return m, nil
+	}
+
+	return Matcher{}, fmt.Errorf("invalid label matcher %q", s)
+}
+
+func ParseMatchers(ss []string) ([]Matcher, error) {
+	ms := make([]Matcher, 0, len(ss))
+	for _, s := range ss {
+		m, err := ParseMatcher(s)
+		if err != nil {
+			return nil, err
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+func (m Matcher) Matches(ls map[string]string) bool {
+	value := ls[m.Name]
+	switch m.Op {
+	case "=":
+		return value == m.Value
+	case "!=":
+		return value != m.Value
+	case "=~":
+		return m.re.MatchString(value)
+	case "!~":
+		return !m.re.MatchString(value)
+	}
+	return false
+}
+
+func MatchAll(ms []Matcher, ls map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(ls) {
+			return false
+		}
+	}
+	return true
+}
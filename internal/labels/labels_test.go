@@ -0,0 +1,23 @@
+package labels
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLabelsKeyRoundTrip(t *testing.T) {
+	key := Key("Alloc", map[string]string{"service": "api", "host": "a\"b"})
+	assert.Equal(t, `Alloc{host="a\"b",service="api"}`, key)
+
+	name, ls, err := Split(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "Alloc", name)
+	assert.Equal(t, map[string]string{"host": "a\"b", "service": "api"}, ls)
+
+	assert.Equal(t, "Alloc", Key("Alloc", nil))
+
+	m, err := ParseMatcher("service=~ap.*")
+	assert.NoError(t, err)
+	assert.True(t, m.Matches(ls))
+}
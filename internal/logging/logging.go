@@ -0,0 +1,96 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+type Config struct {
+	Level      string
+	Format     string
+	File       string
+	MaxSizeMB  int
+	MaxBackups int
+}
+
+func ParseLevel(level string) (zerolog.Level, error) {
+	switch strings.ToLower(level) {
+	case "trace":
+		return zerolog.TraceLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info", "":
+		return zerolog.InfoLevel, nil
+	case "warn", "warning":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	default:
+		return zerolog.NoLevel, fmt.Errorf("unknown log level %q (want trace, debug, info, warn or error)", level)
+	}
+}
+
+func ValidateFormat(format string) error {
+	if format != "json" && format != "console" {
+		return fmt.Errorf("unknown log format %q (want json or console)", format)
+	}
+	return nil
+}
+
+// SetLevel changes the level of every logger in the process.
+func SetLevel(level string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	zerolog.SetGlobalLevel(l)
+	return nil
+}
+
+func Level() string {
+	return zerolog.GlobalLevel().String()
+}
+
+// New builds the process logger tagged with component. The returned closer
+// releases the log file, if any.
+func New(component string, cfg Config) (zerolog.Logger, io.Closer, error) {
+	if err := SetLevel(cfg.Level); err != nil {
+		return zerolog.Nop(), nil, err
+	}
+	if err := ValidateFormat(cfg.Format); err != nil {
+		return zerolog.Nop(), nil, err
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stdout}
+	if cfg.File != "" {
+		f, err := newRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+		if err != nil {
+			return zerolog.Nop(), nil, err
+		}
+		out = f
+	}
+
+	var w io.Writer = out
+	if cfg.Format == "console" {
+		w = zerolog.ConsoleWriter{Out: out, NoColor: cfg.File != ""}
+	}
+
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	logger := zerolog.New(w).With().
+		Timestamp().
+		Str("component", component).
+		Logger()
+	return logger, out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
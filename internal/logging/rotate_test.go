@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := newRotatingFile(path, 10, 2)
+	assert.NoError(t, err)
+
+	f.Write([]byte("aaaaaa\n"))
+	f.Write([]byte("bb\n"))
+	assert.NoFileExists(t, path+".1")
+
+	// The write that would pass the limit goes to a fresh file.
+	f.Write([]byte("cc\n"))
+	assert.Equal(t, "aaaaaa\nbb\n", readFile(t, path+".1"))
+	assert.Equal(t, "cc\n", readFile(t, path))
+
+	f.Write([]byte(strings.Repeat("d", 9) + "\n"))
+	f.Write([]byte("e\n"))
+	assert.Equal(t, "e\n", readFile(t, path))
+	assert.Equal(t, "ddddddddd\n", readFile(t, path+".1"))
+	assert.Equal(t, "cc\n", readFile(t, path+".2"))
+	assert.NoFileExists(t, path+".3")
+	assert.NoError(t, f.Close())
+
+	// Reopening counts what is already in the file towards the limit.
+	f, err = newRotatingFile(path, 10, 2)
+	assert.NoError(t, err)
+	f.Write([]byte("ffffffff\n"))
+	assert.Equal(t, "e\n", readFile(t, path+".1"))
+	assert.Equal(t, "ffffffff\n", readFile(t, path))
+	assert.NoError(t, f.Close())
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	f, err := newRotatingFile(path, 4, 0)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	f.Write([]byte("abc\n"))
+	f.Write([]byte("de\n"))
+	assert.Equal(t, "de\n", readFile(t, path))
+	assert.NoFileExists(t, path+".1")
+}
@@ -1,8 +1,17 @@
 package models
 
 type Metrics struct {
-	ID    string   `json:"id"`
-	MType string   `json:"type"`
-	Delta *int64   `json:"delta,omitempty"`
-	Value *float64 `json:"value,omitempty"`
+	ID     string            `json:"id"`
+	MType  string            `json:"type"`
+	Delta  *int64            `json:"delta,omitempty"`
+	Value  *float64          `json:"value,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+func Gauge(id string, value float64, labels map[string]string) Metrics {
+	return Metrics{ID: id, MType: "gauge", Value: &value, Labels: labels}
+}
+
+func Counter(id string, delta int64, labels map[string]string) Metrics {
+	return Metrics{ID: id, MType: "counter", Delta: &delta, Labels: labels}
 }
@@ -0,0 +1,206 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const (
+	// cumulativeTTL is how long the last value of a cumulative series is kept
+	// without new points before the series is forgotten.
+	cumulativeTTL = time.Hour
+	// maxCumulativeSeries caps the tracked series. Points of new series past
+	// the cap are rejected, since without a previous value there is no delta.
+	maxCumulativeSeries = 100_000
+)
+
+type cumulativeState struct {
+	start uint64
+	value int64
+	seen  time.Time
+}
+
+type Converter struct {
+	mu         sync.Mutex
+	cumulative map[string]cumulativeState
+	expired    time.Time
+	now        func() time.Time
+}
+
+func NewConverter() *Converter {
+	return &Converter{
+		cumulative: make(map[string]cumulativeState),
+		now:        time.Now,
+	}
+}
+
+func attributeValue(v *commonpb.AnyValue) string {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return fmt.Sprint(val.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return fmt.Sprint(val.IntValue)
+	case *commonpb.AnyValue_DoubleValue:
+		return fmt.Sprint(val.DoubleValue)
+	}
+	return ""
+}
+
+func mergeAttributes(dst map[string]string, attrs []*commonpb.KeyValue) map[string]string {
+	result := make(map[string]string, len(dst)+len(attrs))
+	for k, v := range dst {
+		result[k] = v
+	}
+	for _, kv := range attrs {
+		result[labels.SanitizeName(kv.GetKey())] = attributeValue(kv.GetValue())
+	}
+	return result
+}
+
+func pointValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		return v.AsDouble, !math.IsNaN(v.AsDouble) && !math.IsInf(v.AsDouble, 0)
+	case *metricspb.NumberDataPoint_AsInt:
+		return float64(v.AsInt), true
+	}
+	return 0, false
+}
+
+func nonEmpty(ls map[string]string) map[string]string {
+	if len(ls) == 0 {
+		return nil
+	}
+	return ls
+}
+
+// cumulativeDelta returns the increase of a cumulative series since its last
+// point. It reports false when the series is new and the cap is reached.
+func (c *Converter) cumulativeDelta(key string, start uint64, value int64, now time.Time) (int64, bool) {
+	prev, ok := c.cumulative[key]
+	if !ok && len(c.cumulative) >= maxCumulativeSeries {
+		return 0, false
+	}
+	c.cumulative[key] = cumulativeState{start: start, value: value, seen: now}
+
+	if !ok || prev.start != start || value < prev.value {
+		return value, true
+	}
+	return value - prev.value, true
+}
+
+// expire forgets cumulative series that have not reported within
+// cumulativeTTL. It scans the map at most once a minute.
+func (c *Converter) expire(now time.Time) {
+	if now.Sub(c.expired) < time.Minute {
+		return
+	}
+	c.expired = now
+
+	for key, st := range c.cumulative {
+		if now.Sub(st.seen) > cumulativeTTL {
+			delete(c.cumulative, key)
+		}
+	}
+}
+
+func (c *Converter) Convert(req *colmetricspb.ExportMetricsServiceRequest) ([]models.Metrics, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.expire(now)
+
+	var result []models.Metrics
+	var rejected int64
+
+	for _, rm := range req.GetResourceMetrics() {
+		resourceLabels := mergeAttributes(nil, rm.GetResource().GetAttributes())
+
+		for _, sm := range rm.GetScopeMetrics() {
+			scopeLabels := mergeAttributes(resourceLabels, sm.GetScope().GetAttributes())
+
+			for _, metric := range sm.GetMetrics() {
+				name := metric.GetName()
+				if labels.ValidateName(name) != nil || name == "" {
+					rejected += int64(countPoints(metric))
+					continue
+				}
+
+				switch data := metric.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						value, ok := pointValue(dp)
+						if !ok {
+							rejected++
+							continue
+						}
+						ls := nonEmpty(mergeAttributes(scopeLabels, dp.GetAttributes()))
+						result = append(result, models.Gauge(name, value, ls))
+					}
+
+				case *metricspb.Metric_Sum:
+					sum := data.Sum
+					for _, dp := range sum.GetDataPoints() {
+						value, ok := pointValue(dp)
+						if !ok {
+							rejected++
+							continue
+						}
+						ls := nonEmpty(mergeAttributes(scopeLabels, dp.GetAttributes()))
+
+						if !sum.GetIsMonotonic() {
+							result = append(result, models.Gauge(name, value, ls))
+							continue
+						}
+
+						delta := int64(math.Round(value))
+						switch sum.GetAggregationTemporality() {
+						case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+						case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+							if delta, ok = c.cumulativeDelta(labels.Key(name, ls), dp.GetStartTimeUnixNano(), delta, now); !ok {
+								rejected++
+								continue
+							}
+						default:
+							rejected++
+							continue
+						}
+						result = append(result, models.Counter(name, delta, ls))
+					}
+
+				default:
+					rejected += int64(countPoints(metric))
+				}
+			}
+		}
+	}
+
+	return result, rejected
+}
+
+func countPoints(m *metricspb.Metric) int {
+	switch data := m.GetData().(type) {
+	case *metricspb.Metric_Gauge:
+		return len(data.Gauge.GetDataPoints())
+	case *metricspb.Metric_Sum:
+		return len(data.Sum.GetDataPoints())
+	case *metricspb.Metric_Histogram:
+		return len(data.Histogram.GetDataPoints())
+	case *metricspb.Metric_ExponentialHistogram:
+		return len(data.ExponentialHistogram.GetDataPoints())
+	case *metricspb.Metric_Summary:
+		return len(data.Summary.GetDataPoints())
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package otlp
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+func sumRequest(name string, temporality metricspb.AggregationTemporality, start uint64, value int64) *colmetricspb.ExportMetricsServiceRequest {
+	return &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{{
+					Name: name,
+					Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+						IsMonotonic:            true,
+						AggregationTemporality: temporality,
+						DataPoints: []*metricspb.NumberDataPoint{{
+							StartTimeUnixNano: start,
+							Attributes: []*commonpb.KeyValue{{
+								Key:   "http.method",
+								Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "GET"}},
+							}},
+							Value: &metricspb.NumberDataPoint_AsInt{AsInt: value},
+						}},
+					}},
+				}},
+			}},
+		}},
+	}
+}
+
+func convertDelta(t *testing.T, c *Converter, req *colmetricspb.ExportMetricsServiceRequest) int64 {
+	t.Helper()
+	metrics, rejected := c.Convert(req)
+	assert.Zero(t, rejected)
+	if !assert.Len(t, metrics, 1) {
+		return 0
+	}
+	assert.Equal(t, "counter", metrics[0].MType)
+	assert.Equal(t, map[string]string{"http_method": "GET"}, metrics[0].Labels)
+	return *metrics[0].Delta
+}
+
+func TestConvertDeltaTemporality(t *testing.T) {
+	c := NewConverter()
+	delta := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA
+
+	assert.Equal(t, int64(4), convertDelta(t, c, sumRequest("requests", delta, 1, 4)))
+	assert.Equal(t, int64(4), convertDelta(t, c, sumRequest("requests", delta, 1, 4)))
+	assert.Empty(t, c.cumulative)
+}
+
+func TestConvertCumulativeTemporality(t *testing.T) {
+	c := NewConverter()
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	assert.Equal(t, int64(10), convertDelta(t, c, sumRequest("requests", cumulative, 1, 10)))
+	assert.Equal(t, int64(5), convertDelta(t, c, sumRequest("requests", cumulative, 1, 15)))
+
+	// A value going backwards or a new start time is a reset.
+	assert.Equal(t, int64(3), convertDelta(t, c, sumRequest("requests", cumulative, 1, 3)))
+	assert.Equal(t, int64(7), convertDelta(t, c, sumRequest("requests", cumulative, 2, 7)))
+
+	metrics, rejected := c.Convert(sumRequest("requests", metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_UNSPECIFIED, 1, 1))
+	assert.Empty(t, metrics)
+	assert.Equal(t, int64(1), rejected)
+}
+
+func TestConvertExpiresCumulativeSeries(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := NewConverter()
+	c.now = func() time.Time { return now }
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	convertDelta(t, c, sumRequest("old", cumulative, 1, 10))
+	now = now.Add(cumulativeTTL / 2)
+	convertDelta(t, c, sumRequest("fresh", cumulative, 1, 10))
+	assert.Len(t, c.cumulative, 2)
+
+	now = now.Add(cumulativeTTL/2 + time.Minute)
+	assert.Equal(t, int64(5), convertDelta(t, c, sumRequest("fresh", cumulative, 1, 15)))
+	assert.Len(t, c.cumulative, 1)
+
+	// The expired series starts over from its full value.
+	assert.Equal(t, int64(12), convertDelta(t, c, sumRequest("old", cumulative, 1, 12)))
+}
+
+func TestConvertRejectsSeriesPastCap(t *testing.T) {
+	c := NewConverter()
+	cumulative := metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+
+	convertDelta(t, c, sumRequest("tracked", cumulative, 1, 10))
+	for i := len(c.cumulative); i < maxCumulativeSeries; i++ {
+		c.cumulative[fmt.Sprint("filler", i)] = cumulativeState{seen: c.now()}
+	}
+
+	// Known series keep reporting deltas; new ones are rejected rather than
+	// counted in full on every export.
+	assert.Equal(t, int64(5), convertDelta(t, c, sumRequest("tracked", cumulative, 1, 15)))
+	for range 2 {
+		metrics, rejected := c.Convert(sumRequest("untracked", cumulative, 1, 10))
+		assert.Empty(t, metrics)
+		assert.Equal(t, int64(1), rejected)
+	}
+	assert.Len(t, c.cumulative, maxCumulativeSeries)
+}
@@ -0,0 +1,126 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+// Event kinds. An update carries the new value of a metric, a delete the
+// metric that was removed and a reset the counter set back to zero.
+const (
+	KindUpdate = "update"
+	KindDelete = "delete"
+	KindReset  = "reset"
+)
+
+type Event struct {
+	ID     uint64
+	Kind   string
+	Metric models.Metrics
+}
+
+type Filter func(m models.Metrics) bool
+
+type Subscription struct {
+	ch chan Event
+
+	mu     sync.RWMutex
+	filter Filter
+}
+
+func (sub *Subscription) Events() <-chan Event {
+	return sub.ch
+}
+
+func (sub *Subscription) SetFilter(filter Filter) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.filter = filter
+}
+
+func (sub *Subscription) matches(m models.Metrics) bool {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+	return sub.filter == nil || sub.filter(m)
+}
+
+type Hub struct {
+	mu         sync.Mutex
+	lastID     uint64
+	replay     []Event
+	replaySize int
+	subs       map[*Subscription]struct{}
+}
+
+func NewHub(replaySize int) *Hub {
+	return &Hub{
+		replaySize: replaySize,
+		subs:       make(map[*Subscription]struct{}),
+	}
+}
+
+func (h *Hub) Publish(m models.Metrics) uint64 {
+	return h.PublishKind(KindUpdate, m)
+}
+
+func (h *Hub) PublishKind(kind string, m models.Metrics) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	ev := Event{ID: h.lastID, Kind: kind, Metric: m}
+
+	if h.replaySize > 0 {
+		h.replay = append(h.replay, ev)
+		if len(h.replay) > h.replaySize {
+			h.replay = h.replay[len(h.replay)-h.replaySize:]
+		}
+	}
+
+	for sub := range h.subs {
+		if !sub.matches(m) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+
+	return ev.ID
+}
+
+func (h *Hub) Subscribe(filter Filter, lastID uint64, queue int) (*Subscription, []Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &Subscription{
+		ch:     make(chan Event, queue),
+		filter: filter,
+	}
+
+	var backlog []Event
+	if lastID > 0 {
+		for _, ev := range h.replay {
+			if ev.ID > lastID && sub.matches(ev.Metric) {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	h.subs[sub] = struct{}{}
+	return sub, backlog
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
@@ -0,0 +1,195 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+)
+
+type Sink interface {
+	Apply(m models.Metrics) (models.Metrics, error)
+}
+
+type Scheduler struct {
+	targets  []string
+	interval time.Duration
+	timeout  time.Duration
+	sink     Sink
+	logger   zerolog.Logger
+}
+
+func ParseTargets(spec string) []string {
+	var targets []string
+	for _, t := range strings.Split(spec, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+func NewScheduler(targets []string, interval, timeout time.Duration, sink Sink, logger zerolog.Logger) *Scheduler {
+	return &Scheduler{
+		targets:  targets,
+		interval: interval,
+		timeout:  timeout,
+		sink:     sink,
+		logger:   logger,
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	s.logger.Info().
+		Strs("targets", s.targets).
+		Dur("interval", s.interval).
+		Dur("timeout", s.timeout).
+		Msg("scrape scheduler starting")
+
+	var wg sync.WaitGroup
+	for _, t := range s.targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.runTarget(ctx, newTarget(t))
+		}()
+	}
+	wg.Wait()
+}
+
+type target struct {
+	name     string
+	url      string
+	counters map[string]int64
+	// primed is set after the first successful scrape. Counters seen then
+	// only set the baseline, since their totals may already be stored, for
+	// example restored after a server restart.
+	primed bool
+}
+
+func newTarget(addr string) *target {
+	u := addr
+	if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+		u = "http://" + u
+	}
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(u, "http://"), "https://"), "/") {
+		u += "/metrics"
+	}
+
+	return &target{
+		name:     addr,
+		url:      u,
+		counters: make(map[string]int64),
+	}
+}
+
+func (s *Scheduler) runTarget(ctx context.Context, t *target) {
+	client := &http.Client{Timeout: s.timeout}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.scrape(ctx, client, t)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) scrape(ctx context.Context, client *http.Client, t *target) {
+	start := time.Now()
+	metrics, err := fetch(ctx, client, t.url)
+	duration := time.Since(start).Seconds()
+
+	up := 1.0
+	if err != nil {
+		up = 0
+		s.logger.Warn().Err(err).Str("target", t.name).Msg("scrape failed")
+	}
+
+	samples := 0
+	for _, m := range metrics {
+		if m.Labels == nil {
+			m.Labels = make(map[string]string)
+		}
+		if _, ok := m.Labels["instance"]; !ok {
+			m.Labels["instance"] = t.name
+		}
+
+		if m.MType == "counter" && m.Delta != nil {
+			key := labels.Key(m.ID, m.Labels)
+			value := *m.Delta
+			delta := value
+			if prev, ok := t.counters[key]; ok && value >= prev {
+				delta = value - prev
+			}
+			t.counters[key] = value
+			if !t.primed {
+				samples++
+				continue
+			}
+			m.Delta = &delta
+		}
+
+		if _, err := s.sink.Apply(m); err != nil {
+			s.logger.Debug().Err(err).Str("target", t.name).Str("metric", m.ID).Msg("failed to apply scraped metric")
+			continue
+		}
+		samples++
+	}
+	if err == nil {
+		t.primed = true
+	}
+
+	status := map[string]float64{
+		"up":                      up,
+		"scrape_duration_seconds": duration,
+		"scrape_samples":          float64(samples),
+	}
+	for name, value := range status {
+		v := value
+		m := models.Metrics{
+			ID:     name,
+			MType:  "gauge",
+			Value:  &v,
+			Labels: map[string]string{"target": t.name},
+		}
+		if _, err := s.sink.Apply(m); err != nil {
+			s.logger.Error().Err(err).Str("metric", name).Msg("failed to record scrape status")
+		}
+	}
+}
+
+func fetch(ctx context.Context, client *http.Client, url string) ([]models.Metrics, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("response from %s: %d", url, resp.StatusCode)
+	}
+
+	var metrics []models.Metrics
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("decode response from %s: %w", url, err)
+	}
+	return metrics, nil
+}
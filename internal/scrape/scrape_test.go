@@ -0,0 +1,106 @@
+package scrape
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	metrics []models.Metrics
+}
+
+func (s *recordingSink) Apply(m models.Metrics) (models.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m)
+	return m, nil
+}
+
+func (s *recordingSink) named(id string) []models.Metrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var result []models.Metrics
+	for _, m := range s.metrics {
+		if m.ID == id {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+func TestScrapeDeltasAndUp(t *testing.T) {
+	var mu sync.Mutex
+	total := int64(10)
+	agentSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/metrics", r.URL.Path)
+		mu.Lock()
+		v := total
+		total += 5
+		mu.Unlock()
+		metrics := []models.Metrics{
+			models.Counter("requests", v, nil),
+			models.Gauge("load", 0.5, map[string]string{"instance": "custom"}),
+		}
+		if v > 10 {
+			metrics = append(metrics, models.Counter("errors", 2, nil))
+		}
+		json.NewEncoder(w).Encode(metrics)
+	}))
+	defer agentSrv.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer down.Close()
+
+	upAddr := strings.TrimPrefix(agentSrv.URL, "http://")
+	targets := ParseTargets(upAddr + ", " + down.URL + "/metrics")
+	assert.Len(t, targets, 2)
+
+	sink := &recordingSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		NewScheduler(targets, 10*time.Millisecond, time.Second, sink, zerolog.Nop()).Run(ctx)
+	}()
+
+	assert.Eventually(t, func() bool { return len(sink.named("requests")) >= 3 }, 5*time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	// The first scrape only sets the baseline, so totals that may already
+	// be stored are not counted twice.
+	requests := sink.named("requests")
+	assert.Equal(t, int64(5), *requests[0].Delta)
+	assert.Equal(t, int64(5), *requests[1].Delta)
+	assert.Equal(t, int64(5), *requests[2].Delta)
+	assert.Equal(t, map[string]string{"instance": upAddr}, requests[0].Labels)
+
+	// A counter that first shows up after the baseline counts in full.
+	assert.Equal(t, int64(2), *sink.named("errors")[0].Delta)
+	assert.Equal(t, "custom", sink.named("load")[0].Labels["instance"])
+
+	upByTarget := map[string]float64{}
+	for _, m := range sink.named("up") {
+		upByTarget[m.Labels["target"]] = *m.Value
+	}
+	assert.Equal(t, map[string]float64{upAddr: 1, down.URL + "/metrics": 0}, upByTarget)
+
+	for _, m := range sink.named("scrape_samples") {
+		if m.Labels["target"] == upAddr {
+			assert.GreaterOrEqual(t, *m.Value, 2.0)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alex19451/httpserver/internal/logging"
+)
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// effectiveConfig reports the running config. The log level comes from the
+// logger itself, since /admin/log-level can change it without a reload.
+func (s *Server) effectiveConfig(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config().Redacted()
+	cfg.LogLevel = logging.Level()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
+}
+
+func (s *Server) getLogLevel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevel{Level: logging.Level()})
+}
+
+// setLogLevel changes the level until the next restart or config reload.
+func (s *Server) setLogLevel(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if err := logging.SetLevel(req.Level); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.log(r).Info().Str("level", logging.Level()).Msg("log level changed")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(logLevel{Level: logging.Level()})
+}
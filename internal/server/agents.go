@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The registry keeps at most maxAgents agents and maxAgentMetrics metric
+// keys per agent, forgetting the least recently seen ones first, so agents
+// with changing IDs or label values cannot grow it without bound.
+const (
+	maxAgents       = 1000
+	maxAgentMetrics = 1000
+)
+
+type agentInfo struct {
+	ID        string    `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Version   string    `json:"version"`
+	StartTime time.Time `json:"start_time"`
+	LastSeen  time.Time `json:"last_seen"`
+	Metrics   []string  `json:"metrics"`
+	Stale     bool      `json:"stale"`
+}
+
+type agentEntry struct {
+	info    agentInfo
+	metrics map[string]time.Time
+}
+
+type agentRegistry struct {
+	mu     sync.Mutex
+	agents map[string]*agentEntry
+}
+
+func newAgentRegistry() *agentRegistry {
+	return &agentRegistry{
+		agents: make(map[string]*agentEntry),
+	}
+}
+
+func (reg *agentRegistry) observe(h http.Header, key string) {
+	id := h.Get("X-Agent-ID")
+	if id == "" {
+		return
+	}
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := reg.agents[id]
+	if !ok {
+		if len(reg.agents) >= maxAgents {
+			delete(reg.agents, leastRecent(reg.agents, func(e *agentEntry) time.Time { return e.info.LastSeen }))
+		}
+		entry = &agentEntry{
+			info:    agentInfo{ID: id},
+			metrics: make(map[string]time.Time),
+		}
+		reg.agents[id] = entry
+	}
+
+	entry.info.Hostname = h.Get("X-Agent-Hostname")
+	entry.info.Version = h.Get("X-Agent-Version")
+	if startTime, err := time.Parse(time.RFC3339, h.Get("X-Agent-Start-Time")); err == nil {
+		entry.info.StartTime = startTime
+	}
+	entry.info.LastSeen = now
+	if _, ok := entry.metrics[key]; !ok && len(entry.metrics) >= maxAgentMetrics {
+		delete(entry.metrics, leastRecent(entry.metrics, func(t time.Time) time.Time { return t }))
+	}
+	entry.metrics[key] = now
+}
+
+// leastRecent returns the key of m whose seen time is the oldest.
+func leastRecent[V any](m map[string]V, seen func(V) time.Time) string {
+	var oldest string
+	var oldestSeen time.Time
+	for key, v := range m {
+		if t := seen(v); oldest == "" || t.Before(oldestSeen) {
+			oldest, oldestSeen = key, t
+		}
+	}
+	return oldest
+}
+
+func (reg *agentRegistry) list(staleAfter time.Duration) []agentInfo {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	now := time.Now()
+	result := make([]agentInfo, 0, len(reg.agents))
+	for _, entry := range reg.agents {
+		info := entry.info
+		info.Metrics = make([]string, 0, len(entry.metrics))
+		for key := range entry.metrics {
+			info.Metrics = append(info.Metrics, key)
+		}
+		sort.Strings(info.Metrics)
+		info.Stale = now.Sub(info.LastSeen) > staleAfter
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
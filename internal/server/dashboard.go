@@ -0,0 +1,155 @@
+package server
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+//go:embed web
+var webFS embed.FS
+
+var dashboardTmpl = template.Must(template.ParseFS(webFS, "web/dashboard.html"))
+
+const defaultRefresh = 10
+
+type dashboardRow struct {
+	Key       string
+	Name      string
+	Labels    []string
+	Value     string
+	Sparkline string
+}
+
+type dashboardSection struct {
+	Title string
+	Rows  []dashboardRow
+}
+
+type dashboardData struct {
+	Query    string
+	Refresh  int
+	Sections []dashboardSection
+}
+
+func staticHandler() http.Handler {
+	static, err := fs.Sub(webFS, "web/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix("/static/", http.FileServer(http.FS(static)))
+}
+
+func sparkline(points []float64) string {
+	if len(points) < 2 {
+		return ""
+	}
+
+	lo, hi := points[0], points[0]
+	for _, p := range points {
+		lo = min(lo, p)
+		hi = max(hi, p)
+	}
+
+	var b strings.Builder
+	step := 100 / float64(len(points)-1)
+	for i, p := range points {
+		y := 10.0
+		if hi > lo {
+			y = 19 - (p-lo)/(hi-lo)*18
+		}
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(strconv.FormatFloat(float64(i)*step, 'f', 1, 64))
+		b.WriteByte(',')
+		b.WriteString(strconv.FormatFloat(y, 'f', 1, 64))
+	}
+	return b.String()
+}
+
+func (s *Server) dashboardRow(m models.Metrics) dashboardRow {
+	key := labels.Key(m.ID, m.Labels)
+
+	row := dashboardRow{
+		Key:       key,
+		Name:      m.ID,
+		Sparkline: sparkline(s.history.get(m.MType, key)),
+	}
+	if m.Value != nil {
+		row.Value = strconv.FormatFloat(*m.Value, 'f', -1, 64)
+	} else if m.Delta != nil {
+		row.Value = strconv.FormatInt(*m.Delta, 10)
+	}
+
+	for _, k := range sortedLabelNames(m.Labels) {
+		row.Labels = append(row.Labels, k+"="+m.Labels[k])
+	}
+	return row
+}
+
+func sortedLabelNames(ls map[string]string) []string {
+	names := make([]string, 0, len(ls))
+	for k := range ls {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) getAll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	matchers, err := labels.ParseMatchers(q["match"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	refresh := defaultRefresh
+	if v := q.Get("refresh"); v != "" {
+		refresh, err = strconv.Atoi(v)
+		if err != nil || refresh < 0 {
+			http.Error(w, "invalid refresh interval", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data := dashboardData{
+		Query:   q.Get("q"),
+		Refresh: refresh,
+		Sections: []dashboardSection{
+			{Title: "Gauges"},
+			{Title: "Counters"},
+		},
+	}
+	search := strings.ToLower(data.Query)
+
+	for _, m := range s.snapshot() {
+		if !labels.MatchAll(matchers, m.Labels) {
+			continue
+		}
+		row := s.dashboardRow(m)
+		if search != "" && !strings.Contains(strings.ToLower(row.Key), search) {
+			continue
+		}
+
+		if m.MType == "gauge" {
+			data.Sections[0].Rows = append(data.Sections[0].Rows, row)
+		} else {
+			data.Sections[1].Rows = append(data.Sections[1].Rows, row)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTmpl.Execute(w, data); err != nil {
+		s.log(r).Error().Err(err).Msg("error rendering dashboard")
+	}
+}
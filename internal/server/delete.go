@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/alex19451/httpserver/internal/forward"
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/alex19451/httpserver/internal/pubsub"
+	"github.com/go-chi/chi/v5"
+)
+
+// deleteKey removes a series and tells subscribers and upstream servers.
+// Callers save the storage once they are done deleting.
+func (s *Server) deleteKey(r *http.Request, metricType, key string) bool {
+	var deleted bool
+	switch metricType {
+	case "gauge":
+		deleted = s.db.DeleteGauge(key)
+	case "counter":
+		deleted = s.db.DeleteCounter(key)
+	}
+	if !deleted {
+		return false
+	}
+
+	s.history.forget(metricType, key)
+	name, ls, _ := labels.Split(key)
+	m := models.Metrics{ID: name, MType: metricType, Labels: ls}
+	s.hub.PublishKind(pubsub.KindDelete, m)
+	if s.forwarder != nil {
+		s.forwarder.EnqueueOp(forward.OpDelete, m)
+	}
+
+	s.log(r).Info().
+		Str("type", metricType).
+		Str("metric", key).
+		Msg("metric deleted")
+	return true
+}
+
+func (s *Server) deleteValue(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "type")
+	key := labels.Key(chi.URLParam(r, "name"), labelsFromQuery(r.URL.Query()))
+
+	if metricType != "gauge" && metricType != "counter" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !s.deleteKey(r, metricType, key) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.save()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func matchPattern(p models.Metrics, key string) bool {
+	name, ls, err := labels.Split(key)
+	if err != nil {
+		return false
+	}
+	if ok, err := path.Match(p.ID, name); err != nil || !ok {
+		return false
+	}
+	for k, v := range p.Labels {
+		if ls[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) deleteJSON(w http.ResponseWriter, r *http.Request) {
+	var patterns []models.Metrics
+	if !s.decodeJSON(w, r, &patterns) {
+		return
+	}
+
+	for _, p := range patterns {
+		if p.ID == "" {
+			http.Error(w, "id pattern is required", http.StatusBadRequest)
+			return
+		}
+		if _, err := path.Match(p.ID, ""); err != nil {
+			http.Error(w, "invalid pattern "+p.ID, http.StatusBadRequest)
+			return
+		}
+		if p.MType != "" && p.MType != "gauge" && p.MType != "counter" {
+			http.Error(w, "invalid metric type", http.StatusBadRequest)
+			return
+		}
+	}
+
+	gauges, counters := s.db.GetAll()
+	keys := map[string][]string{}
+	for key := range gauges {
+		keys["gauge"] = append(keys["gauge"], key)
+	}
+	for key := range counters {
+		keys["counter"] = append(keys["counter"], key)
+	}
+	sort.Strings(keys["gauge"])
+	sort.Strings(keys["counter"])
+
+	deleted := make([]models.Metrics, 0)
+	for _, p := range patterns {
+		for _, metricType := range []string{"gauge", "counter"} {
+			if p.MType != "" && p.MType != metricType {
+				continue
+			}
+			for _, key := range keys[metricType] {
+				if !matchPattern(p, key) || !s.deleteKey(r, metricType, key) {
+					continue
+				}
+				name, ls, _ := labels.Split(key)
+				deleted = append(deleted, models.Metrics{ID: name, MType: metricType, Labels: ls})
+			}
+		}
+	}
+
+	if len(deleted) > 0 {
+		s.save()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deleted)
+}
+
+func (s *Server) resetCounter(w http.ResponseWriter, r *http.Request) {
+	key := labels.Key(chi.URLParam(r, "name"), labelsFromQuery(r.URL.Query()))
+
+	if !s.db.ResetCounter(key) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	s.history.record("counter", key, 0)
+	s.save()
+
+	name, ls, _ := labels.Split(key)
+	zero := int64(0)
+	m := models.Metrics{ID: name, MType: "counter", Delta: &zero, Labels: ls}
+	s.hub.PublishKind(pubsub.KindReset, m)
+	if s.forwarder != nil {
+		s.forwarder.EnqueueOp(forward.OpReset, m)
+	}
+
+	s.log(r).Info().Str("metric", key).Msg("counter reset")
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,49 @@
+package server
+
+import "sync"
+
+const historySize = 60
+
+type history struct {
+	mu     sync.Mutex
+	series map[string][]float64
+}
+
+func newHistory() *history {
+	return &history{
+		series: make(map[string][]float64),
+	}
+}
+
+func historyKey(metricType, key string) string {
+	return metricType + ":" + key
+}
+
+func (h *history) record(metricType, key string, value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	k := historyKey(metricType, key)
+	points := append(h.series[k], value)
+	if len(points) > historySize {
+		points = points[len(points)-historySize:]
+	}
+	h.series[k] = points
+}
+
+func (h *history) get(metricType, key string) []float64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	points := h.series[historyKey(metricType, key)]
+	result := make([]float64, len(points))
+	copy(result, points)
+	return result
+}
+
+func (h *history) forget(metricType, key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.series, historyKey(metricType, key))
+}
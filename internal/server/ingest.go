@@ -0,0 +1,63 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/ingest"
+)
+
+const maxInfluxBodySize = 16 << 20
+
+// influxWrite checks every line before applying any of them, so a batch
+// with a bad line is rejected as a whole and can be retried once fixed.
+func (s *Server) influxWrite(w http.ResponseWriter, r *http.Request) {
+	body := io.ReadCloser(http.MaxBytesReader(w, r.Body, maxInfluxBodySize))
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// The limit also applies after decompression.
+		body = http.MaxBytesReader(w, gz, maxInfluxBodySize)
+	}
+
+	metrics, errs := ingest.ParseInflux(body, s.rules())
+	for _, err := range errs {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+	for _, lm := range metrics {
+		if err := validateMetric(lm.Metric); err != nil {
+			errs = append(errs, ingest.LineError{Line: lm.Line, Err: err})
+		}
+	}
+
+	if len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		s.log(r).Warn().
+			Int("rejected", len(errs)).
+			Msg("influx write contained invalid lines")
+		http.Error(w, strings.Join(msgs, "\n"), http.StatusBadRequest)
+		return
+	}
+
+	for _, lm := range metrics {
+		if _, err := s.Apply(lm.Metric); err != nil {
+			s.log(r).Error().Err(err).Int("line", lm.Line).Msg("failed to apply influx metric")
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
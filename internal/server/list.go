@@ -0,0 +1,255 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+func (s *Server) snapshot() []models.Metrics {
+	gauges, counters := s.db.GetAll()
+	result := make([]models.Metrics, 0, len(gauges)+len(counters))
+
+	for key, val := range gauges {
+		name, ls, err := labels.Split(key)
+		if err != nil {
+			continue
+		}
+		v := val
+		result = append(result, models.Metrics{ID: name, MType: "gauge", Value: &v, Labels: ls})
+	}
+	for key, val := range counters {
+		name, ls, err := labels.Split(key)
+		if err != nil {
+			continue
+		}
+		d := val
+		result = append(result, models.Metrics{ID: name, MType: "counter", Delta: &d, Labels: ls})
+	}
+
+	sortMetrics(result, "name")
+	return result
+}
+
+type listFilter struct {
+	mtype    string
+	prefix   string
+	glob     string
+	re       *regexp.Regexp
+	matchers []labels.Matcher
+}
+
+func parseListFilter(q url.Values) (listFilter, error) {
+	f := listFilter{
+		mtype:  q.Get("type"),
+		prefix: q.Get("prefix"),
+		glob:   q.Get("glob"),
+	}
+
+	if f.mtype != "" && f.mtype != "gauge" && f.mtype != "counter" {
+		return listFilter{}, errors.New("invalid metric type")
+	}
+	if f.glob != "" {
+		if _, err := path.Match(f.glob, ""); err != nil {
+			return listFilter{}, fmt.Errorf("invalid glob: %w", err)
+		}
+	}
+	if expr := q.Get("regex"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return listFilter{}, fmt.Errorf("invalid regex: %w", err)
+		}
+		f.re = re
+	}
+
+	matchers, err := labels.ParseMatchers(q["match"])
+	if err != nil {
+		return listFilter{}, err
+	}
+	f.matchers = matchers
+
+	return f, nil
+}
+
+func (f listFilter) matches(m models.Metrics) bool {
+	if f.mtype != "" && m.MType != f.mtype {
+		return false
+	}
+	if !strings.HasPrefix(m.ID, f.prefix) {
+		return false
+	}
+	if f.glob != "" {
+		if ok, _ := path.Match(f.glob, m.ID); !ok {
+			return false
+		}
+	}
+	if f.re != nil && !f.re.MatchString(m.ID) {
+		return false
+	}
+	return labels.MatchAll(f.matchers, m.Labels)
+}
+
+func metricValue(m models.Metrics) float64 {
+	if m.Value != nil {
+		return *m.Value
+	}
+	if m.Delta != nil {
+		return float64(*m.Delta)
+	}
+	return 0
+}
+
+func sortMetrics(ms []models.Metrics, order string) bool {
+	byKey := func(i, j int) bool {
+		ki, kj := labels.Key(ms[i].ID, ms[i].Labels), labels.Key(ms[j].ID, ms[j].Labels)
+		if ki != kj {
+			return ki < kj
+		}
+		return ms[i].MType < ms[j].MType
+	}
+
+	var less func(i, j int) bool
+	switch order {
+	case "", "name":
+		less = byKey
+	case "-name":
+		less = func(i, j int) bool { return byKey(j, i) }
+	case "type":
+		less = func(i, j int) bool {
+			if ms[i].MType != ms[j].MType {
+				return ms[i].MType < ms[j].MType
+			}
+			return byKey(i, j)
+		}
+	case "value":
+		less = func(i, j int) bool {
+			vi, vj := metricValue(ms[i]), metricValue(ms[j])
+			if vi != vj {
+				return vi < vj
+			}
+			return byKey(i, j)
+		}
+	case "-value":
+		less = func(i, j int) bool {
+			vi, vj := metricValue(ms[i]), metricValue(ms[j])
+			if vi != vj {
+				return vi > vj
+			}
+			return byKey(i, j)
+		}
+	default:
+		return false
+	}
+
+	sort.SliceStable(ms, less)
+	return true
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
+
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) listMetrics(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	filter, err := parseListFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := decodeCursor(q.Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	result := make([]models.Metrics, 0)
+	for _, m := range s.snapshot() {
+		if filter.matches(m) {
+			result = append(result, m)
+		}
+	}
+	total := len(result)
+
+	if !sortMetrics(result, q.Get("sort")) {
+		http.Error(w, "invalid sort order", http.StatusBadRequest)
+		return
+	}
+
+	if offset > len(result) {
+		offset = len(result)
+	}
+	result = result[offset:]
+	if limit > 0 && limit < len(result) {
+		result = result[:limit]
+		w.Header().Set("X-Next-Cursor", encodeCursor(offset+limit))
+	}
+
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf.Bytes())
+}
@@ -1,7 +1,14 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -10,6 +17,7 @@ import (
 type responseWriterWrapper struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int
 }
 
 func (w *responseWriterWrapper) WriteHeader(statusCode int) {
@@ -17,7 +25,78 @@ func (w *responseWriterWrapper) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
-func LoggingMiddleware(logger zerolog.Logger) func(next http.Handler) http.Handler {
+func (w *responseWriterWrapper) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+func (w *responseWriterWrapper) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *responseWriterWrapper) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.statusCode = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+type requestIDKey struct{}
+
+const maxRequestIDLength = 128
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware tags each request with the X-Request-ID it came with,
+// or a new one, echoes it in the response and stores it in the context along
+// with a logger that includes it.
+func RequestIDMiddleware(logger zerolog.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get("X-Request-ID")
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			w.Header().Set("X-Request-ID", id)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = logger.With().Str("request_id", id).Logger().WithContext(ctx)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// LoggingMiddleware logs every request that fails and one in sample of the
+// rest.
+func LoggingMiddleware(logger zerolog.Logger, sample int) func(next http.Handler) http.Handler {
+	sampled := logger
+	if sample > 1 {
+		sampled = logger.Sample(&zerolog.BasicSampler{N: uint32(sample)})
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
@@ -31,12 +110,42 @@ func LoggingMiddleware(logger zerolog.Logger) func(next http.Handler) http.Handl
 
 			duration := time.Since(start)
 
-			logger.Info().
+			l := sampled
+			if ww.statusCode >= http.StatusBadRequest {
+				l = logger
+			}
+
+			l.Info().
+				Str("request_id", RequestID(r.Context())).
 				Str("uri", r.RequestURI).
 				Str("method", r.Method).
 				Dur("duration", duration).
 				Int("status_code", ww.statusCode).
+				Int("bytes", ww.bytes).
+				Str("remote_addr", r.RemoteAddr).
+				Str("user_agent", r.UserAgent()).
 				Msg("request")
 		})
 	}
 }
+
+func AdminAuthMiddleware(adminToken func() string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := adminToken()
+			if token == "" {
+				http.Error(w, "admin API is disabled", http.StatusForbidden)
+				return
+			}
+
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const maxOTLPBodySize = 16 << 20
+
+func (s *Server) otlpMetrics(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-protobuf" && mediaType != "application/json" {
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxOTLPBodySize)
+	body := io.Reader(r.Body)
+	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// The limit also applies after decompression, so a small gzip body
+	// cannot expand into an unbounded allocation.
+	data, err := io.ReadAll(io.LimitReader(body, maxOTLPBodySize+1))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || len(data) > maxOTLPBodySize {
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req colmetricspb.ExportMetricsServiceRequest
+	if mediaType == "application/json" {
+		err = protojson.Unmarshal(data, &req)
+	} else {
+		err = proto.Unmarshal(data, &req)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("decode OTLP request: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	metrics, rejected := s.otlp.Convert(&req)
+	for _, m := range metrics {
+		if _, err := s.Apply(m); err != nil {
+			s.log(r).Warn().Err(err).Str("metric", m.ID).Msg("failed to apply OTLP metric")
+			rejected++
+		}
+	}
+
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "unsupported or invalid data points were dropped",
+		}
+	}
+
+	var out []byte
+	if mediaType == "application/json" {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
@@ -3,60 +3,174 @@ package server
 import (
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/alex19451/httpserver/internal/config"
+	"github.com/alex19451/httpserver/internal/forward"
+	"github.com/alex19451/httpserver/internal/ingest"
+	"github.com/alex19451/httpserver/internal/labels"
 	"github.com/alex19451/httpserver/internal/models"
+	"github.com/alex19451/httpserver/internal/otlp"
+	"github.com/alex19451/httpserver/internal/pubsub"
 	"github.com/alex19451/httpserver/internal/storage"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog"
 )
 
+const hubReplaySize = 1024
+
 type Server struct {
-	cfg    *config.ServerConfig
-	db     *storage.Storage
-	logger zerolog.Logger
+	db      *storage.Storage
+	logger  zerolog.Logger
+	agents  *agentRegistry
+	history *history
+	hub     *pubsub.Hub
+	otlp    *otlp.Converter
+
+	forwarder     *forward.Forwarder
+	storeInterval chan time.Duration
+
+	mu        sync.RWMutex
+	cfg       *config.ServerConfig
+	typeRules ingest.TypeRules
 }
 
 func New(cfg *config.ServerConfig, db *storage.Storage, logger zerolog.Logger) *Server {
 	return &Server{
-		cfg:    cfg,
-		db:     db,
-		logger: logger,
+		cfg:           cfg,
+		db:            db,
+		logger:        logger,
+		agents:        newAgentRegistry(),
+		history:       newHistory(),
+		hub:           pubsub.NewHub(hubReplaySize),
+		otlp:          otlp.NewConverter(),
+		storeInterval: make(chan time.Duration, 1),
+	}
+}
+
+func (s *Server) config() *config.ServerConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// log returns the request-scoped logger set by RequestIDMiddleware.
+func (s *Server) log(r *http.Request) *zerolog.Logger {
+	if l := zerolog.Ctx(r.Context()); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return &s.logger
+}
+
+func (s *Server) rules() ingest.TypeRules {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.typeRules
+}
+
+// Reload applies a new config to the running server. Settings that need a
+// restart keep their current values and are logged; the rest take effect
+// immediately.
+// ValidateConfig checks the rule specs in cfg, which the config package
+// leaves to the server since it owns their parsers.
+func ValidateConfig(cfg *config.ServerConfig) error {
+	var errs []error
+	if _, err := ingest.ParseTypeRules(cfg.IngestTypeRules); err != nil {
+		errs = append(errs, fmt.Errorf("ingest_type_rules: %w", err))
+	}
+	if _, err := forward.ParseTargets(cfg.ForwardTargets); err != nil {
+		errs = append(errs, fmt.Errorf("forward_targets: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Server) Reload(next *config.ServerConfig) error {
+	if err := ValidateConfig(next); err != nil {
+		return err
+	}
+	typeRules, err := ingest.ParseTypeRules(next.IngestTypeRules)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	merged, rejected := s.cfg.MergeReload(next)
+	storeChanged := merged.StoreInterval != s.cfg.StoreInterval
+	s.cfg = merged
+	s.typeRules = typeRules
+	if storeChanged {
+		// Replace an interval the store loop has not picked up yet, so
+		// reloading never waits on the loop.
+		select {
+		case <-s.storeInterval:
+		default:
+		}
+		select {
+		case s.storeInterval <- time.Duration(merged.StoreInterval):
+		default:
+		}
+	}
+	s.mu.Unlock()
+
+	for _, name := range rejected {
+		s.logger.Warn().Str("setting", name).Msg("setting cannot change at runtime, restart to apply it")
 	}
+
+	s.logger.Info().
+		Dur("store_interval", time.Duration(merged.StoreInterval)).
+		Str("log_level", merged.LogLevel).
+		Int("rejected", len(rejected)).
+		Msg("config reloaded")
+	return nil
+}
+
+func (s *Server) SetForwarder(f *forward.Forwarder) {
+	s.forwarder = f
 }
 
 func (s *Server) Run() error {
-	if s.cfg.Restore {
+	cfg := s.config()
+
+	typeRules, err := ingest.ParseTypeRules(cfg.IngestTypeRules)
+	if err != nil {
+		return fmt.Errorf("parse ingest type rules: %w", err)
+	}
+	s.mu.Lock()
+	s.typeRules = typeRules
+	s.mu.Unlock()
+
+	if cfg.Restore {
 		if err := s.db.LoadFromFile(); err != nil {
 			s.logger.Error().Err(err).Msg("error loading from file")
 		}
 	}
 
-	if s.cfg.StoreInterval == 0 {
-		s.logger.Info().Msg("sync save mode enabled")
-	} else {
-		go func() {
-			ticker := time.NewTicker(time.Duration(s.cfg.StoreInterval) * time.Second)
-			defer ticker.Stop()
-
-			for range ticker.C {
-				if err := s.db.SaveToFile(); err != nil {
-					s.logger.Error().Err(err).Msg("error saving to file")
-				} else {
-					s.logger.Info().Msg("metrics saved to file")
-				}
-			}
-		}()
-	}
+	go s.storeLoop(time.Duration(cfg.StoreInterval))
+
+	s.logger.Info().
+		Str("address", cfg.Address).
+		Dur("store_interval", time.Duration(cfg.StoreInterval)).
+		Str("file_path", cfg.FileStoragePath).
+		Bool("restore", cfg.Restore).
+		Msg("server starting")
+
+	return http.ListenAndServe(cfg.Address, s.Handler())
+}
 
+// Handler returns the router serving the metrics API.
+func (s *Server) Handler() http.Handler {
+	cfg := s.config()
 	r := chi.NewRouter()
 
-	r.Use(LoggingMiddleware(s.logger))
+	r.Use(RequestIDMiddleware(s.logger))
+	r.Use(LoggingMiddleware(s.logger, cfg.LogSample))
 	r.Use(GzipMiddleware)
 
 	r.Post("/update/{type}/{name}/{value}", s.update)
@@ -66,6 +180,27 @@ func (s *Server) Run() error {
 	r.Post("/value/", s.valueJSON)
 
 	r.Get("/", s.getAll)
+	r.Handle("/static/*", staticHandler())
+	r.Get("/agents", s.listAgents)
+	r.Get("/api/metrics", s.listMetrics)
+	r.Get("/stream", s.stream)
+	r.Get("/ws", s.serveWS)
+	r.Post("/write", s.influxWrite)
+	r.Post("/v1/metrics", s.otlpMetrics)
+
+	if s.forwarder != nil {
+		r.Get("/forward/status", s.forwardStatus)
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Use(AdminAuthMiddleware(func() string { return s.config().AdminToken }))
+		r.Delete("/value/{type}/{name}", s.deleteValue)
+		r.Delete("/value/", s.deleteJSON)
+		r.Post("/reset/counter/{name}", s.resetCounter)
+		r.Get("/admin/config", s.effectiveConfig)
+		r.Get("/admin/log-level", s.getLogLevel)
+		r.Put("/admin/log-level", s.setLogLevel)
+	})
 
 	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
@@ -75,14 +210,125 @@ func (s *Server) Run() error {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	})
 
-	s.logger.Info().
-		Str("address", s.cfg.Address).
-		Int("store_interval", s.cfg.StoreInterval).
-		Str("file_path", s.cfg.FileStoragePath).
-		Bool("restore", s.cfg.Restore).
-		Msg("server starting")
+	return r
+}
+
+// storeLoop saves the storage every interval. An interval of zero means every
+// update is saved synchronously, so the loop only waits for a new interval.
+func (s *Server) storeLoop(interval time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
 
-	return http.ListenAndServe(s.cfg.Address, r)
+	reset := func(d time.Duration) {
+		ticker.Stop()
+		if d == 0 {
+			s.logger.Info().Msg("sync save mode enabled")
+			return
+		}
+		ticker.Reset(d)
+	}
+	reset(interval)
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.db.SaveToFile(); err != nil {
+				s.logger.Error().Err(err).Msg("error saving to file")
+			} else {
+				s.logger.Info().Msg("metrics saved to file")
+			}
+		case d := <-s.storeInterval:
+			reset(d)
+		}
+	}
+}
+
+// validateMetric reports whether Apply would accept m.
+func validateMetric(m models.Metrics) error {
+	if err := labels.ValidateName(m.ID); err != nil {
+		return err
+	}
+	if err := labels.Validate(m.Labels); err != nil {
+		return err
+	}
+	switch m.MType {
+	case "gauge":
+		if m.Value == nil {
+			return errors.New("value is required for gauge")
+		}
+	case "counter":
+		if m.Delta == nil {
+			return errors.New("delta is required for counter")
+		}
+	default:
+		return errors.New("invalid metric type")
+	}
+	return nil
+}
+
+func (s *Server) Apply(m models.Metrics) (models.Metrics, error) {
+	if err := validateMetric(m); err != nil {
+		return models.Metrics{}, err
+	}
+	key := labels.Key(m.ID, m.Labels)
+
+	resp := models.Metrics{
+		ID:     m.ID,
+		MType:  m.MType,
+		Labels: m.Labels,
+	}
+
+	switch m.MType {
+	case "gauge":
+		s.db.UpdateGauge(key, *m.Value)
+		s.history.record(m.MType, key, *m.Value)
+		resp.Value = m.Value
+	case "counter":
+		total := s.db.UpdateCounter(key, *m.Delta)
+		s.history.record(m.MType, key, float64(total))
+		resp.Delta = &total
+	}
+	s.syncSave()
+	s.hub.Publish(resp)
+	if s.forwarder != nil {
+		s.forwarder.Enqueue(m)
+	}
+
+	return resp, nil
+}
+
+func (s *Server) syncSave() {
+	if s.config().StoreInterval != 0 {
+		return
+	}
+	s.save()
+}
+
+// save writes the storage file now. Deletes and resets use it whatever the
+// store interval, so a removed metric does not come back after a restart.
+func (s *Server) save() {
+	if err := s.db.SaveToFile(); err != nil {
+		s.logger.Error().Err(err).Msg("error saving to file")
+	}
+}
+
+// labelQueryPrefix marks the query parameters that carry labels, e.g.
+// "?label.host=a", so other parameters never end up in the series key.
+const labelQueryPrefix = "label."
+
+func labelsFromQuery(q url.Values) map[string]string {
+	var ls map[string]string
+	for k := range q {
+		name, ok := strings.CutPrefix(k, labelQueryPrefix)
+		if !ok {
+			continue
+		}
+		if ls == nil {
+			ls = make(map[string]string)
+		}
+		ls[name] = q.Get(k)
+	}
+	return ls
 }
 
 func (s *Server) update(w http.ResponseWriter, r *http.Request) {
@@ -95,196 +341,155 @@ func (s *Server) update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metrics := models.Metrics{
+		ID:     name,
+		MType:  metricType,
+		Labels: labelsFromQuery(r.URL.Query()),
+	}
+
+	log := s.log(r).With().Str("metric", name).Str("type", metricType).Logger()
+
 	if metricType == "gauge" {
 		val, err := strconv.ParseFloat(value, 64)
 		if err != nil {
+			log.Warn().Err(err).Msg("invalid gauge value")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		s.db.UpdateGauge(name, val)
-		w.WriteHeader(http.StatusOK)
-
-		if s.cfg.StoreInterval == 0 {
-			if err := s.db.SaveToFile(); err != nil {
-				s.logger.Error().Err(err).Msg("error saving to file")
-			}
-		}
-
+		metrics.Value = &val
 	} else if metricType == "counter" {
 		val, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
+			log.Warn().Err(err).Msg("invalid counter value")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		s.db.UpdateCounter(name, val)
-		w.WriteHeader(http.StatusOK)
-
-		if s.cfg.StoreInterval == 0 {
-			if err := s.db.SaveToFile(); err != nil {
-				s.logger.Error().Err(err).Msg("error saving to file")
-			}
-		}
-
+		metrics.Delta = &val
 	} else {
+		log.Warn().Msg("invalid metric type")
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
+
+	if _, err := s.Apply(metrics); err != nil {
+		log.Warn().Err(err).Msg("update rejected")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.agents.observe(r.Header, labels.Key(metrics.ID, metrics.Labels))
+	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) updateJSON(w http.ResponseWriter, r *http.Request) {
+func readJSON(r *http.Request, v any) error {
 	body := r.Body
 	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
 		gz, err := gzip.NewReader(r.Body)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return err
 		}
 		defer gz.Close()
 		body = gz
 	}
 
 	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
-		return
+		return errors.New("Content-Type must be application/json")
 	}
 
-	var metrics models.Metrics
-	if err := json.NewDecoder(body).Decode(&metrics); err != nil {
+	return json.NewDecoder(body).Decode(v)
+}
+
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := readJSON(r, v); err != nil {
+		s.log(r).Warn().Err(err).Msg("invalid JSON request")
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return false
+	}
+	return true
+}
+
+func (s *Server) decodeMetrics(w http.ResponseWriter, r *http.Request) (models.Metrics, bool) {
+	var metrics models.Metrics
+	if !s.decodeJSON(w, r, &metrics) {
+		return models.Metrics{}, false
 	}
 
 	if metrics.ID == "" || metrics.MType == "" {
+		s.log(r).Warn().Str("metric", metrics.ID).Str("type", metrics.MType).Msg("metric request without id or type")
 		http.Error(w, "id and type are required", http.StatusBadRequest)
-		return
+		return models.Metrics{}, false
 	}
 
-	if metrics.MType == "gauge" {
-		if metrics.Value == nil {
-			http.Error(w, "value is required for gauge", http.StatusBadRequest)
-			return
-		}
-		s.db.UpdateGauge(metrics.ID, *metrics.Value)
-
-		if s.cfg.StoreInterval == 0 {
-			if err := s.db.SaveToFile(); err != nil {
-				s.logger.Error().Err(err).Msg("error saving to file")
-			}
-		}
-
-		resp := models.Metrics{
-			ID:    metrics.ID,
-			MType: metrics.MType,
-			Value: metrics.Value,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
-
-	} else if metrics.MType == "counter" {
-		if metrics.Delta == nil {
-			http.Error(w, "delta is required for counter", http.StatusBadRequest)
-			return
-		}
-		total := s.db.UpdateCounter(metrics.ID, *metrics.Delta)
-
-		if s.cfg.StoreInterval == 0 {
-			if err := s.db.SaveToFile(); err != nil {
-				s.logger.Error().Err(err).Msg("error saving to file")
-			}
-		}
-
-		resp := models.Metrics{
-			ID:    metrics.ID,
-			MType: metrics.MType,
-			Delta: &total,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
-
-	} else {
-		http.Error(w, "invalid metric type", http.StatusBadRequest)
-		return
-	}
+	return metrics, true
 }
 
-func (s *Server) valueJSON(w http.ResponseWriter, r *http.Request) {
-	body := r.Body
-	if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
-		gz, err := gzip.NewReader(r.Body)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		defer gz.Close()
-		body = gz
-	}
-
-	if r.Header.Get("Content-Type") != "application/json" {
-		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+func (s *Server) updateJSON(w http.ResponseWriter, r *http.Request) {
+	metrics, ok := s.decodeMetrics(w, r)
+	if !ok {
 		return
 	}
 
-	var metrics models.Metrics
-	if err := json.NewDecoder(body).Decode(&metrics); err != nil {
+	resp, err := s.Apply(metrics)
+	if err != nil {
+		s.log(r).Warn().Err(err).Str("metric", metrics.ID).Str("type", metrics.MType).Msg("update rejected")
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	s.agents.observe(r.Header, labels.Key(metrics.ID, metrics.Labels))
 
-	if metrics.ID == "" || metrics.MType == "" {
-		http.Error(w, "id and type are required", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) valueJSON(w http.ResponseWriter, r *http.Request) {
+	metrics, ok := s.decodeMetrics(w, r)
+	if !ok {
 		return
 	}
+	key := labels.Key(metrics.ID, metrics.Labels)
+
+	resp := models.Metrics{
+		ID:     metrics.ID,
+		MType:  metrics.MType,
+		Labels: metrics.Labels,
+	}
 
 	if metrics.MType == "gauge" {
-		val, ok := s.db.GetGauge(metrics.ID)
+		val, ok := s.db.GetGauge(key)
 		if !ok {
 			http.Error(w, "metric not found", http.StatusNotFound)
 			return
 		}
-
-		resp := models.Metrics{
-			ID:    metrics.ID,
-			MType: metrics.MType,
-			Value: &val,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-
+		resp.Value = &val
 	} else if metrics.MType == "counter" {
-		val, ok := s.db.GetCounter(metrics.ID)
+		val, ok := s.db.GetCounter(key)
 		if !ok {
 			http.Error(w, "metric not found", http.StatusNotFound)
 			return
 		}
-
-		resp := models.Metrics{
-			ID:    metrics.ID,
-			MType: metrics.MType,
-			Delta: &val,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(resp)
-
+		resp.Delta = &val
 	} else {
 		http.Error(w, "invalid metric type", http.StatusBadRequest)
 		return
 	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (s *Server) getValue(w http.ResponseWriter, r *http.Request) {
 	metricType := chi.URLParam(r, "type")
 	name := chi.URLParam(r, "name")
+	key := labels.Key(name, labelsFromQuery(r.URL.Query()))
 
 	if metricType == "gauge" {
-		if val, ok := s.db.GetGauge(name); ok {
+		if val, ok := s.db.GetGauge(key); ok {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(strconv.FormatFloat(val, 'f', -1, 64)))
 			return
 		}
 	} else if metricType == "counter" {
-		if val, ok := s.db.GetCounter(name); ok {
+		if val, ok := s.db.GetCounter(key); ok {
 			w.WriteHeader(http.StatusOK)
 			w.Write([]byte(strconv.FormatInt(val, 10)))
 			return
@@ -294,21 +499,14 @@ func (s *Server) getValue(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
 }
 
-func (s *Server) getAll(w http.ResponseWriter, r *http.Request) {
-	gauges, counters := s.db.GetAll()
+func (s *Server) listAgents(w http.ResponseWriter, r *http.Request) {
+	staleAfter := time.Duration(s.config().AgentStaleTimeout)
 
-	html := `<html><body><h1>Metrics</h1><h2>Gauges</h2><ul>`
-
-	for name, val := range gauges {
-		html += fmt.Sprintf("<li>%s: %f</li>", name, val)
-	}
-	html += `</ul><h2>Counters</h2><ul>`
-
-	for name, val := range counters {
-		html += fmt.Sprintf("<li>%s: %d</li>", name, val)
-	}
-	html += `</ul></body></html>`
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.agents.list(staleAfter))
+}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
+func (s *Server) forwardStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.forwarder.Status())
 }
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/pubsub"
+)
+
+const (
+	streamSubscriberQueue = 64
+	streamHeartbeat       = 15 * time.Second
+)
+
+func writeStreamEvent(w http.ResponseWriter, ev pubsub.Event) error {
+	data, err := json.Marshal(ev.Metric)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Kind, data)
+	return err
+}
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseListFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var lastID uint64
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		lastID, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sub, backlog := s.hub.Subscribe(filter.matches, lastID, streamSubscriberQueue)
+	defer s.hub.Unsubscribe(sub)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	for _, ev := range backlog {
+		if err := writeStreamEvent(w, ev); err != nil {
+			return
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		s.log(r).Error().Err(err).Msg("streaming is not supported by response writer")
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case ev, ok := <-sub.Events():
+			if !ok {
+				s.log(r).Warn().
+					Str("remote_addr", r.RemoteAddr).
+					Msg("dropping slow stream subscriber")
+				return
+			}
+			if err := writeStreamEvent(w, ev); err != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
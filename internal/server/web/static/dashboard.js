@@ -0,0 +1,23 @@
+(function () {
+  var root = document.documentElement;
+  var saved = localStorage.getItem("theme");
+  if (saved) {
+    root.setAttribute("data-theme", saved);
+  }
+
+  document.getElementById("theme-toggle").addEventListener("click", function () {
+    var dark = root.getAttribute("data-theme") === "dark" ||
+      (!root.getAttribute("data-theme") && window.matchMedia("(prefers-color-scheme: dark)").matches);
+    var next = dark ? "light" : "dark";
+    root.setAttribute("data-theme", next);
+    localStorage.setItem("theme", next);
+  });
+
+  var search = document.getElementById("search");
+  search.addEventListener("input", function () {
+    var q = search.value.toLowerCase();
+    document.querySelectorAll("tbody tr").forEach(function (row) {
+      row.hidden = row.dataset.key.toLowerCase().indexOf(q) < 0;
+    });
+  });
+})();
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"net/http"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second
+	wsPongWait       = 60 * time.Second
+	wsPingPeriod     = wsPongWait * 9 / 10
+	wsMaxMessageSize = 4096
+	wsMessageRate    = 10
+	wsMessageBurst   = 20
+	// wsQueue is the number of updates buffered per subscriber before it is
+	// dropped as too slow.
+	wsQueue = 256
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+type wsMessage struct {
+	Type     string           `json:"type"`
+	Patterns []string         `json:"patterns,omitempty"`
+	EventID  uint64           `json:"event_id,omitempty"`
+	Metric   *models.Metrics  `json:"metric,omitempty"`
+	Metrics  []models.Metrics `json:"metrics,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (l *rateLimiter) allow() bool {
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func patternFilter(patterns map[string]struct{}) func(m models.Metrics) bool {
+	list := make([]string, 0, len(patterns))
+	for p := range patterns {
+		list = append(list, p)
+	}
+
+	return func(m models.Metrics) bool {
+		for _, p := range list {
+			if ok, _ := path.Match(p, m.ID); ok {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func sortedPatterns(patterns map[string]struct{}) []string {
+	list := make([]string, 0, len(patterns))
+	for p := range patterns {
+		list = append(list, p)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func (s *Server) serveWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.log(r).Warn().Err(err).Msg("websocket upgrade failed")
+		return
+	}
+	defer conn.Close()
+
+	patterns := make(map[string]struct{})
+	sub, _ := s.hub.Subscribe(patternFilter(patterns), 0, wsQueue)
+	defer s.hub.Unsubscribe(sub)
+
+	out := make(chan wsMessage, 16)
+	done := make(chan struct{})
+	defer close(done)
+
+	// The writer closes writerDone when it gives up on the connection, so a
+	// handler blocked on a full out channel is released instead of leaking.
+	writerDone := make(chan struct{})
+	go func() {
+		ping := time.NewTicker(wsPingPeriod)
+		defer ping.Stop()
+		defer conn.Close()
+		defer close(writerDone)
+
+		for {
+			var msg wsMessage
+			select {
+			case <-done:
+				return
+
+			case ev, ok := <-sub.Events():
+				if !ok {
+					conn.WriteControl(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "subscriber too slow"),
+						time.Now().Add(wsWriteWait))
+					return
+				}
+				metric := ev.Metric
+				msg = wsMessage{Type: ev.Kind, EventID: ev.ID, Metric: &metric}
+
+			case msg = <-out:
+
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return
+				}
+				continue
+			}
+
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		}
+	}()
+
+	reply := func(msg wsMessage) bool {
+		select {
+		case out <- msg:
+			return true
+		case <-writerDone:
+			return false
+		}
+	}
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	limiter := newRateLimiter(wsMessageRate, wsMessageBurst)
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.log(r).Debug().Err(err).Msg("websocket read failed")
+			}
+			return
+		}
+
+		if !limiter.allow() {
+			if !reply(wsMessage{Type: "error", Error: "rate limit exceeded"}) {
+				return
+			}
+			continue
+		}
+
+		switch msg.Type {
+		case "subscribe", "unsubscribe":
+			for _, p := range msg.Patterns {
+				if _, err := path.Match(p, ""); err != nil {
+					if !reply(wsMessage{Type: "error", Error: "invalid pattern " + p}) {
+						return
+					}
+					continue
+				}
+				if msg.Type == "subscribe" {
+					patterns[p] = struct{}{}
+				} else {
+					delete(patterns, p)
+				}
+			}
+			sub.SetFilter(patternFilter(patterns))
+			if !reply(wsMessage{Type: "subscribed", Patterns: sortedPatterns(patterns)}) {
+				return
+			}
+
+		case "snapshot":
+			filter := patternFilter(patterns)
+			metrics := make([]models.Metrics, 0)
+			for _, m := range s.snapshot() {
+				if filter(m) {
+					metrics = append(metrics, m)
+				}
+			}
+			if !reply(wsMessage{Type: "snapshot", Metrics: metrics}) {
+				return
+			}
+
+		default:
+			if !reply(wsMessage{Type: "error", Error: "unknown message type " + msg.Type}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package statsd
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/alex19451/httpserver/internal/models"
+)
+
+type series struct {
+	name string
+	tags map[string]string
+}
+
+type gaugeState struct {
+	series
+	value float64
+	dirty bool
+}
+
+// counterState keeps the fractional part of a sampled counter between
+// flushes, so "hits:1|c|@0.3" adds up instead of rounding away.
+type counterState struct {
+	series
+	value float64
+	dirty bool
+}
+
+type timerState struct {
+	series
+	values []float64
+	count  float64
+}
+
+type setState struct {
+	series
+	members map[string]struct{}
+}
+
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]*counterState
+	gauges   map[string]*gaugeState
+	timers   map[string]*timerState
+	sets     map[string]*setState
+}
+
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters: make(map[string]*counterState),
+		gauges:   make(map[string]*gaugeState),
+		timers:   make(map[string]*timerState),
+		sets:     make(map[string]*setState),
+	}
+}
+
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := labels.Key(s.Name, s.Tags)
+	ser := series{name: s.Name, tags: s.Tags}
+
+	switch s.Type {
+	case "c":
+		c, ok := a.counters[key]
+		if !ok {
+			c = &counterState{series: ser}
+			a.counters[key] = c
+		}
+		c.value += s.Value / s.SampleRate
+		c.dirty = true
+
+	case "g":
+		g, ok := a.gauges[key]
+		if !ok {
+			g = &gaugeState{series: ser}
+			a.gauges[key] = g
+		}
+		if s.Relative {
+			g.value += s.Value
+		} else {
+			g.value = s.Value
+		}
+		g.dirty = true
+
+	case "ms", "h":
+		t, ok := a.timers[key]
+		if !ok {
+			t = &timerState{series: ser}
+			a.timers[key] = t
+		}
+		t.values = append(t.values, s.Value)
+		t.count += 1 / s.SampleRate
+
+	case "s":
+		st, ok := a.sets[key]
+		if !ok {
+			st = &setState{series: ser, members: make(map[string]struct{})}
+			a.sets[key] = st
+		}
+		st.members[s.SetMember] = struct{}{}
+	}
+}
+
+func percentile(sorted []float64, p float64) float64 {
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
+
+func (a *Aggregator) Flush() []models.Metrics {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var result []models.Metrics
+
+	for key, c := range a.counters {
+		// A counter idle for a whole interval is forgotten with whatever
+		// fraction it still holds.
+		if !c.dirty {
+			delete(a.counters, key)
+			continue
+		}
+		delta := math.Trunc(c.value)
+		c.value -= delta
+		c.dirty = false
+		result = append(result, models.Counter(c.series.name, int64(delta), c.series.tags))
+	}
+
+	for _, g := range a.gauges {
+		if g.dirty {
+			result = append(result, models.Gauge(g.series.name, g.value, g.series.tags))
+			g.dirty = false
+		}
+	}
+
+	for _, t := range a.timers {
+		values := t.values
+		sort.Float64s(values)
+
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+
+		result = append(result,
+			models.Counter(t.series.name+".count", int64(math.Round(t.count)), t.series.tags),
+			models.Gauge(t.series.name+".min", values[0], t.series.tags),
+			models.Gauge(t.series.name+".max", values[len(values)-1], t.series.tags),
+			models.Gauge(t.series.name+".mean", sum/float64(len(values)), t.series.tags),
+			models.Gauge(t.series.name+".p50", percentile(values, 0.5), t.series.tags),
+			models.Gauge(t.series.name+".p95", percentile(values, 0.95), t.series.tags),
+			models.Gauge(t.series.name+".p99", percentile(values, 0.99), t.series.tags),
+		)
+	}
+	a.timers = make(map[string]*timerState)
+
+	for _, st := range a.sets {
+		result = append(result, models.Gauge(st.series.name, float64(len(st.members)), st.series.tags))
+	}
+	a.sets = make(map[string]*setState)
+
+	return result
+}
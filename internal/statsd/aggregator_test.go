@@ -0,0 +1,85 @@
+package statsd
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/alex19451/httpserver/internal/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+func addLines(t *testing.T, agg *Aggregator, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		s, err := ParseLine(line)
+		assert.NoError(t, err, line)
+		agg.Add(s)
+	}
+}
+
+func flushed(agg *Aggregator) map[string]float64 {
+	result := make(map[string]float64)
+	for _, m := range agg.Flush() {
+		key := m.MType + ":" + labels.Key(m.ID, m.Labels)
+		if m.Value != nil {
+			result[key] = *m.Value
+		} else {
+			result[key] = float64(*m.Delta)
+		}
+	}
+	return result
+}
+
+func TestAggregatorCounters(t *testing.T) {
+	agg := NewAggregator()
+
+	addLines(t, agg, "hits:1|c|@0.1", "hits:1|c", "hits:2|c|#env:prod")
+	assert.Equal(t, map[string]float64{
+		"counter:hits":             11,
+		`counter:hits{env="prod"}`: 2,
+	}, flushed(agg))
+
+	// Fractions carry over to the next flush instead of being rounded away.
+	addLines(t, agg, "sampled:1|c|@0.4")
+	assert.Equal(t, map[string]float64{"counter:sampled": 2}, flushed(agg))
+	addLines(t, agg, "sampled:1|c|@0.4")
+	assert.Equal(t, map[string]float64{"counter:sampled": 3}, flushed(agg))
+
+	// Idle counters are not reported again.
+	assert.Empty(t, flushed(agg))
+	assert.Empty(t, agg.counters)
+}
+
+func TestAggregatorGauges(t *testing.T) {
+	agg := NewAggregator()
+
+	addLines(t, agg, "depth:10|g", "depth:+5|g", "depth:-3|g")
+	assert.Equal(t, map[string]float64{"gauge:depth": 12}, flushed(agg))
+
+	// Unchanged gauges are skipped; relative updates apply to the last value.
+	assert.Empty(t, flushed(agg))
+	addLines(t, agg, "depth:-2|g")
+	assert.Equal(t, map[string]float64{"gauge:depth": 10}, flushed(agg))
+}
+
+func TestAggregatorTimersAndSets(t *testing.T) {
+	agg := NewAggregator()
+
+	for i := 1; i <= 100; i++ {
+		addLines(t, agg, "latency:"+strconv.Itoa(i)+"|ms|@0.5")
+	}
+	addLines(t, agg, "users:alice|s", "users:bob|s", "users:alice|s")
+
+	got := flushed(agg)
+	assert.Equal(t, 200.0, got["counter:latency.count"])
+	assert.Equal(t, 1.0, got["gauge:latency.min"])
+	assert.Equal(t, 100.0, got["gauge:latency.max"])
+	assert.Equal(t, 50.5, got["gauge:latency.mean"])
+	assert.Equal(t, 50.0, got["gauge:latency.p50"])
+	assert.Equal(t, 95.0, got["gauge:latency.p95"])
+	assert.Equal(t, 99.0, got["gauge:latency.p99"])
+	assert.Equal(t, 2.0, got["gauge:users"])
+
+	// Timers and sets start over after each flush.
+	assert.NotContains(t, flushed(agg), "gauge:users")
+}
@@ -0,0 +1,188 @@
+package statsd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+)
+
+const maxPacketSize = 65535
+
+type Sink interface {
+	Apply(m models.Metrics) (models.Metrics, error)
+}
+
+type Listener struct {
+	udpAddr       string
+	tcpAddr       string
+	flushInterval time.Duration
+	sink          Sink
+	agg           *Aggregator
+	logger        zerolog.Logger
+}
+
+func NewListener(udpAddr, tcpAddr string, flushInterval time.Duration, sink Sink, logger zerolog.Logger) *Listener {
+	return &Listener{
+		udpAddr:       udpAddr,
+		tcpAddr:       tcpAddr,
+		flushInterval: flushInterval,
+		sink:          sink,
+		agg:           NewAggregator(),
+		logger:        logger,
+	}
+}
+
+func (l *Listener) Run(ctx context.Context) error {
+	var udpConn net.PacketConn
+	var tcpLn net.Listener
+	var err error
+
+	if l.udpAddr != "" {
+		udpConn, err = net.ListenPacket("udp", l.udpAddr)
+		if err != nil {
+			return err
+		}
+		defer udpConn.Close()
+	}
+
+	if l.tcpAddr != "" {
+		tcpLn, err = net.Listen("tcp", l.tcpAddr)
+		if err != nil {
+			return err
+		}
+		defer tcpLn.Close()
+	}
+
+	l.logger.Info().
+		Str("udp_address", l.udpAddr).
+		Str("tcp_address", l.tcpAddr).
+		Dur("flush_interval", l.flushInterval).
+		Msg("statsd listener starting")
+
+	var wg sync.WaitGroup
+	if udpConn != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveUDP(udpConn)
+		}()
+	}
+	if tcpLn != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveTCP(tcpLn)
+		}()
+	}
+
+	ticker := time.NewTicker(l.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if udpConn != nil {
+				udpConn.Close()
+			}
+			if tcpLn != nil {
+				tcpLn.Close()
+			}
+			wg.Wait()
+			l.flush()
+			return nil
+
+		case <-ticker.C:
+			l.flush()
+		}
+	}
+}
+
+func (l *Listener) flush() {
+	for _, m := range l.agg.Flush() {
+		if _, err := l.sink.Apply(m); err != nil {
+			l.logger.Warn().Err(err).Str("metric", m.ID).Msg("failed to apply statsd metric")
+		}
+	}
+}
+
+func (l *Listener) handlePacket(data string) {
+	for _, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		sample, err := ParseLine(line)
+		if err != nil {
+			l.logger.Debug().Err(err).Msg("invalid statsd line")
+			continue
+		}
+		l.agg.Add(sample)
+	}
+}
+
+func (l *Listener) serveUDP(conn net.PacketConn) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logger.Error().Err(err).Msg("statsd udp read failed")
+			}
+			return
+		}
+		l.handlePacket(string(buf[:n]))
+	}
+}
+
+// serveTCP returns once the listener is closed and every connection handler
+// has finished, so the final flush sees all of their samples.
+func (l *Listener) serveTCP(ln net.Listener) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	conns := make(map[net.Conn]struct{})
+
+	defer func() {
+		mu.Lock()
+		for conn := range conns {
+			conn.SetReadDeadline(time.Now())
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				l.logger.Error().Err(err).Msg("statsd tcp accept failed")
+			}
+			return
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				mu.Lock()
+				delete(conns, conn)
+				mu.Unlock()
+				conn.Close()
+			}()
+
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				l.handlePacket(scanner.Text())
+			}
+		}()
+	}
+}
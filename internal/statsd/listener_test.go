@@ -0,0 +1,80 @@
+package statsd
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alex19451/httpserver/internal/models"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	metrics []models.Metrics
+}
+
+func (s *recordingSink) Apply(m models.Metrics) (models.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = append(s.metrics, m)
+	return m, nil
+}
+
+func TestListenerWaitsForTCPConnections(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	sink := &recordingSink{}
+	l := NewListener("", addr, time.Hour, sink, zerolog.Nop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Run(ctx) }()
+
+	var conns []net.Conn
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return false
+		}
+		conns = append(conns, conn)
+		return true
+	}, time.Second, 10*time.Millisecond)
+	idle, err := net.Dial("tcp", addr)
+	assert.NoError(t, err)
+	defer idle.Close()
+
+	_, err = conns[0].Write([]byte("hits:3|c\n"))
+	assert.NoError(t, err)
+	defer conns[0].Close()
+	assert.Eventually(t, func() bool {
+		l.agg.mu.Lock()
+		defer l.agg.mu.Unlock()
+		return len(l.agg.counters) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The idle connection must not keep Run from returning.
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+
+	// Every handler has finished and closed its side by the time Run returns.
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	assert.Len(t, sink.metrics, 1)
+	assert.Equal(t, int64(3), *sink.metrics[0].Delta)
+}
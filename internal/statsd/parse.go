@@ -0,0 +1,88 @@
+package statsd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alex19451/httpserver/internal/labels"
+)
+
+type Sample struct {
+	Name       string
+	Type       string
+	Value      float64
+	Relative   bool
+	SetMember  string
+	SampleRate float64
+	Tags       map[string]string
+}
+
+func ParseLine(line string) (Sample, error) {
+	line = strings.TrimSpace(line)
+
+	bar := strings.IndexByte(line, '|')
+	if bar < 0 {
+		return Sample{}, fmt.Errorf("malformed line %q", line)
+	}
+	colon := strings.LastIndexByte(line[:bar], ':')
+	if colon <= 0 {
+		return Sample{}, fmt.Errorf("malformed line %q", line)
+	}
+
+	s := Sample{
+		Name:       line[:colon],
+		SampleRate: 1,
+	}
+	raw := line[colon+1 : bar]
+	parts := strings.Split(line[bar+1:], "|")
+
+	s.Type = parts[0]
+	switch s.Type {
+	case "c", "g", "ms", "h":
+	case "s":
+		s.SetMember = raw
+	default:
+		return Sample{}, fmt.Errorf("unknown metric type %q in %q", s.Type, line)
+	}
+
+	if s.Type != "s" {
+		if s.Type == "g" && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-")) {
+			s.Relative = true
+		}
+		v, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return Sample{}, fmt.Errorf("invalid value %q in %q", raw, line)
+		}
+		s.Value = v
+	}
+
+	for _, p := range parts[1:] {
+		switch {
+		case strings.HasPrefix(p, "@"):
+			rate, err := strconv.ParseFloat(p[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return Sample{}, fmt.Errorf("invalid sample rate %q in %q", p, line)
+			}
+			s.SampleRate = rate
+		case strings.HasPrefix(p, "#"):
+			s.Tags = parseTags(p[1:])
+		default:
+			return Sample{}, fmt.Errorf("unknown section %q in %q", p, line)
+		}
+	}
+
+	return s, nil
+}
+
+func parseTags(raw string) map[string]string {
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(raw, ",") {
+		if tag == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(tag, ":")
+		tags[labels.SanitizeName(k)] = v
+	}
+	return tags
+}
@@ -0,0 +1,24 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLine(t *testing.T) {
+	s, err := ParseLine("api.requests:3|c|@0.5|#env:prod,region:eu-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "api.requests", s.Name)
+	assert.Equal(t, "c", s.Type)
+	assert.Equal(t, 3.0, s.Value)
+	assert.Equal(t, 0.5, s.SampleRate)
+	assert.Equal(t, map[string]string{"env": "prod", "region": "eu-1"}, s.Tags)
+
+	s, err = ParseLine("queue.depth:-2|g")
+	assert.NoError(t, err)
+	assert.True(t, s.Relative)
+
+	_, err = ParseLine("broken|c")
+	assert.Error(t, err)
+}
@@ -1,6 +1,9 @@
 package storage
 
+import "sync"
+
 type Storage struct {
+	mu       sync.RWMutex
 	Gauges   map[string]float64
 	Counters map[string]int64
 	file     *FileStorage
@@ -21,26 +24,41 @@ func NewWithFile(filePath string) *Storage {
 	}
 }
 
-func (s *Storage) UpdateGauge(name string, value float64) {
-	s.Gauges[name] = value
+func (s *Storage) UpdateGauge(key string, value float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Gauges[key] = value
 }
 
-func (s *Storage) GetGauge(name string) (float64, bool) {
-	val, ok := s.Gauges[name]
+func (s *Storage) GetGauge(key string) (float64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	val, ok := s.Gauges[key]
 	return val, ok
 }
 
-func (s *Storage) UpdateCounter(name string, delta int64) int64 {
-	s.Counters[name] += delta
-	return s.Counters[name]
+func (s *Storage) UpdateCounter(key string, delta int64) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Counters[key] += delta
+	return s.Counters[key]
 }
 
-func (s *Storage) GetCounter(name string) (int64, bool) {
-	val, ok := s.Counters[name]
+func (s *Storage) GetCounter(key string) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	val, ok := s.Counters[key]
 	return val, ok
 }
 
 func (s *Storage) GetAll() (map[string]float64, map[string]int64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	gauges := make(map[string]float64, len(s.Gauges))
 	for k, v := range s.Gauges {
 		gauges[k] = v
@@ -54,10 +72,47 @@ func (s *Storage) GetAll() (map[string]float64, map[string]int64) {
 	return gauges, counters
 }
 
+func (s *Storage) DeleteGauge(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Gauges[key]; !ok {
+		return false
+	}
+	delete(s.Gauges, key)
+	return true
+}
+
+func (s *Storage) DeleteCounter(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Counters[key]; !ok {
+		return false
+	}
+	delete(s.Counters, key)
+	return true
+}
+
+func (s *Storage) ResetCounter(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Counters[key]; !ok {
+		return false
+	}
+	s.Counters[key] = 0
+	return true
+}
+
 func (s *Storage) SaveToFile() error {
 	if s.file == nil {
 		return nil
 	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
 	return s.file.Save(s.Gauges, s.Counters)
 }
 
@@ -70,6 +125,9 @@ func (s *Storage) LoadFromFile() error {
 		return err
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	s.Gauges = gauges
 	s.Counters = counters
 	return nil